@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/shashankgroovy/morag/output"
+	"github.com/shashankgroovy/morag/spotify"
+	"github.com/shashankgroovy/morag/utils"
+	"github.com/spf13/cobra"
+)
+
+// artistCmd represents the artist command
+var artistCmd = &cobra.Command{
+	Use:   "artist",
+	Short: "Fetches the profile of an artist.",
+	Long: `Fetches the profile of one or more artists from Spotify: their genres,
+follower count, popularity and images.
+
+Just like fetch, artistIDs, spotify:artist URIs, open.spotify.com links and
+plain artist names are accepted. The profiles are written as a table to
+stdout, or to a file with --output.
+
+USAGE:
+$ morag artist [artistID...]
+
+EXAMPLE:
+$ morag artist 0OdUWJ0sBjDrqHygGUXeCF
+$ morag artist "Band of Horses" 4Z8W4fKeB5YxbusRsdQVPb --format json
+$ morag artist 0OdUWJ0sBjDrqHygGUXeCF --format sqlite -o catalog.db
+`,
+	Run: artist,
+}
+
+var artistOutputFile string
+var artistFormat string
+
+func init() {
+	rootCmd.AddCommand(artistCmd)
+
+	artistCmd.Flags().StringVarP(&artistOutputFile, "output", "o", "", "Output file (default is stdout)")
+	artistCmd.Flags().StringVar(&artistFormat, "format", "csv", "Output format: "+strings.Join(output.Formats, ", "))
+}
+
+func artist(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		// Print error, help text and exit
+		fmt.Printf("\nERROR: Please provide a Spotify artistID.\n\n")
+		cmd.Help()
+		return
+	}
+
+	// Without a file the artists are printed to stdout, to be piped
+	// elsewhere, and everything else to stderr
+	out := os.Stdout
+	if artistOutputFile == "" {
+		restore := stdoutToStderr()
+		defer restore()
+	}
+
+	// check if a user is already authenticated
+	authToken, err := utils.TestAndSetToken()
+	if err != nil {
+		log.Println("Error while setting the auth token", err.Error())
+		return
+	}
+
+	ctx := context.Background()
+	client := spotify.NewClient(authToken.AccessToken)
+
+	artistIDs := resolveArtists(ctx, client, args)
+	if len(artistIDs) < 1 {
+		color.Red("None of the given artists could be found")
+		return
+	}
+
+	artists, err := lookupArtists(ctx, client, artistIDs, nil)
+	if err != nil {
+		log.Println("Error while fetching artists", err.Error())
+		return
+	}
+
+	var w output.Writer
+	if artistOutputFile == "" {
+		w, err = output.New(artistFormat, out, true, nil)
+	} else {
+		w, err = output.Create(artistFormat, artistOutputFile, output.Options{})
+	}
+	if err != nil {
+		log.Println("[WRITER] Cannot create file", err)
+		return
+	}
+	if err := writeArtists(w, artists); err != nil {
+		log.Println("[WRITER] Error", err.Error())
+	}
+}
+
+// lookupArtists retrieves the full artist objects of artistIDs, in batches
+// of up to spotify.MaxArtistIDs. Once stop is closed no more batches are
+// requested.
+func lookupArtists(ctx context.Context, client *spotify.Client, artistIDs []string, stop <-chan struct{}) ([]utils.FullArtist, error) {
+	if len(artistIDs) == 1 {
+		artist, err := client.Artist(ctx, artistIDs[0])
+		if err != nil {
+			return nil, err
+		}
+		return []utils.FullArtist{*artist}, nil
+	}
+
+	var artists []utils.FullArtist
+	for start := 0; start < len(artistIDs); start += spotify.MaxArtistIDs {
+		if stopped(stop) {
+			break
+		}
+		end := start + spotify.MaxArtistIDs
+		if end > len(artistIDs) {
+			end = len(artistIDs)
+		}
+
+		// Fire it away
+		color.Cyan("[lookupArtists] Getting %d artists", end-start)
+		batch, err := client.Artists(ctx, artistIDs[start:end])
+		if err != nil {
+			return artists, err
+		}
+		artists = append(artists, batch...)
+	}
+	return artists, nil
+}
+
+// writeArtists writes a row per artist to w and closes it
+func writeArtists(w output.Writer, artists []utils.FullArtist) error {
+	var err error
+	for _, artist := range artists {
+		if err = w.Write(artist.Row()); err != nil {
+			break
+		}
+	}
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// writeCredited looks up the profiles of artistIDs and writes them to the
+// artist table of fetch
+func writeCredited(ctx context.Context, client *spotify.Client, opts fetchOptions, artistIDs []string, stop <-chan struct{}) {
+	color.Green("\n[fetch] Fetching the profiles of %d artists", len(artistIDs))
+	artists, err := lookupArtists(ctx, client, artistIDs, stop)
+	if err != nil {
+		log.Println("Error while fetching artists", err.Error())
+	}
+	if len(artists) == 0 {
+		return
+	}
+
+	path := artistsPath(opts.file, opts.format)
+	w, err := output.Create(opts.format, path, output.Options{Append: opts.resume})
+	if err != nil {
+		log.Println("[WRITER] Cannot create file", err)
+		return
+	}
+	if err := writeArtists(w, artists); err != nil {
+		log.Println("[WRITER] Error", err.Error())
+		return
+	}
+	color.Green("[fetch] Wrote %d of %d artists to %s", len(artists), len(artistIDs), path)
+}
+
+// artistsPath returns the file fetch writes the artist table to: next to
+// the output as <output>_artists.<ext>, or for SQLite the database itself
+func artistsPath(file, format string) string {
+	path := outputFileFor(file, format)
+	if strings.ToLower(format) == "sqlite" {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "_artists" + ext
+}
+
+// artistSet collects artist ids in the order they are first seen
+type artistSet struct {
+	sync.Mutex
+	ids  []string
+	seen map[string]bool
+}
+
+func (s *artistSet) add(ids ...string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.seen == nil {
+		s.seen = make(map[string]bool)
+	}
+	for _, id := range ids {
+		if id != "" && !s.seen[id] {
+			s.seen[id] = true
+			s.ids = append(s.ids, id)
+		}
+	}
+}
+
+func (s *artistSet) list() []string {
+	s.Lock()
+	defer s.Unlock()
+	return append([]string{}, s.ids...)
+}
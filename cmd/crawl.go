@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/shashankgroovy/morag/output"
+	"github.com/shashankgroovy/morag/spotify"
+	"github.com/shashankgroovy/morag/utils"
+	"github.com/spf13/cobra"
+)
+
+// crawlCmd represents the crawl command
+var crawlCmd = &cobra.Command{
+	Use:   "crawl",
+	Short: "Maps the artists related to an artist.",
+	Long: `Crawl starts from one or more artists and follows the artists Spotify
+lists as related to them, then the ones related to those and so on, to map
+out a scene or the roster of a label. Artists are visited breadth first,
+every artist only once, until --depth steps away from where the crawl
+started or until --max-artists artists were found.
+
+The graph is written as an edge list (a CSV file with a row per relation),
+as GraphML for Gephi or yEd, or as DOT for Graphviz. Relations point from
+an artist to one Spotify lists as related to it. Those among the artists
+found on the last step are not looked up.
+
+With --fetch the catalog of every artist found is fetched afterwards, as
+fetch would, to --catalog-output.
+
+USAGE:
+$ morag crawl [artistID...]
+
+EXAMPLE:
+$ morag crawl 0OdUWJ0sBjDrqHygGUXeCF
+$ morag crawl "Band of Horses" --depth 3 --max-artists 500 --format graphml
+$ morag crawl 0OdUWJ0sBjDrqHygGUXeCF --format dot -o scene.dot
+$ morag crawl 0OdUWJ0sBjDrqHygGUXeCF --depth 1 --fetch --catalog-output scene.csv
+`,
+	Run: crawl,
+}
+
+var crawlDepth int
+var crawlMaxArtists int
+var graphFile string
+var graphFormat string
+var crawlFetch bool
+var crawlRate float64
+var crawlCatalog outputOptions
+
+func init() {
+	rootCmd.AddCommand(crawlCmd)
+
+	crawlCmd.Flags().IntVar(&crawlDepth, "depth", 2, "Number of steps to follow related artists away from where the crawl starts")
+	crawlCmd.Flags().IntVar(&crawlMaxArtists, "max-artists", 100, "Stop adding artists to the graph once it holds this many")
+	crawlCmd.Flags().StringVarP(&graphFile, "output", "o", "", "Output file (default is graph.csv, graph.graphml or graph.dot)")
+	crawlCmd.Flags().StringVar(&graphFormat, "format", "edges", "Graph format: "+strings.Join(output.GraphFormats, ", "))
+	crawlCmd.Flags().BoolVar(&crawlFetch, "fetch", false, "Fetch the catalog of every artist found")
+	crawlCmd.Flags().StringVar(&crawlCatalog.file, "catalog-output", "", "Output file of --fetch (default is $OUTPUT_FILE or output.<format>)")
+	crawlCmd.Flags().StringVar(&crawlCatalog.format, "catalog-format", "csv", "Output format of --fetch: "+strings.Join(output.Formats, ", "))
+	crawlCmd.Flags().Float64Var(&crawlRate, "rate", 10, "Maximum number of requests per second")
+}
+
+func crawl(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		// Print error, help text and exit
+		fmt.Printf("\nERROR: Please provide a Spotify artistID.\n\n")
+		cmd.Help()
+		return
+	}
+
+	if err := checkGraphFormat(graphFormat); err != nil {
+		log.Println("Error in graph format", err.Error())
+		return
+	}
+	if crawlMaxArtists <= 0 {
+		log.Printf("Error in crawl options: --max-artists must be above 0, got %d", crawlMaxArtists)
+		return
+	}
+
+	graph, ok := crawlGraph(args)
+	if graph == nil {
+		return
+	}
+
+	if !ok {
+		color.Red("Interrupted, the graph only holds the artists found so far")
+		os.Exit(exitPartial)
+	}
+
+	if crawlFetch {
+		var artistIDs []string
+		for _, node := range graph.Nodes {
+			artistIDs = append(artistIDs, node.Id)
+		}
+		color.Green("\n[crawl] Fetching the catalogs of %d artists", len(artistIDs))
+		catalog := crawlCatalog
+		catalog.rate = crawlRate
+		fetchArtists(artistIDs, fetchOptions{outputOptions: catalog, concurrency: defaultConcurrency})
+	}
+}
+
+// checkGraphFormat makes sure format is one of output.GraphFormats
+func checkGraphFormat(format string) error {
+	for _, f := range output.GraphFormats {
+		if f == strings.ToLower(format) {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown format %q, use one of %s", format, strings.Join(output.GraphFormats, ", "))
+}
+
+// crawlGraph crawls the artists related to those given and writes out the
+// graph. It returns nil if the crawl could not be done, and false if it was
+// interrupted.
+func crawlGraph(inputs []string) (*output.Graph, bool) {
+	// check if a user is already authenticated
+	authToken, err := utils.TestAndSetToken()
+	if err != nil {
+		log.Println("Error while setting the auth token", err.Error())
+		return nil, false
+	}
+
+	ctx, stop, release := watchInterrupts()
+	defer release()
+
+	client := spotify.NewClient(authToken.AccessToken)
+	client.Limiter = spotify.NewLimiter(crawlRate, 1)
+	client.OnRateLimit = func(cooldown time.Duration) {
+		color.Red("[crawl] Rate limited, pausing for %s", cooldown)
+	}
+
+	artistIDs := resolveArtists(ctx, client, inputs)
+	if len(artistIDs) < 1 {
+		color.Red("None of the given artists could be found")
+		return nil, false
+	}
+	seeds, err := lookupArtists(ctx, client, artistIDs, stop)
+	if err != nil {
+		log.Println("Error while fetching artists", err.Error())
+		return nil, false
+	}
+
+	graph, failed, interrupted := crawlRelated(ctx, client, seeds, crawlDepth, crawlMaxArtists, stop)
+
+	path := graphFile
+	if path == "" {
+		path = "graph" + output.GraphExtension(graphFormat)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		log.Println("[WRITER] Cannot create file", err)
+		return nil, false
+	}
+	defer file.Close()
+	if err := output.WriteGraph(graphFormat, file, graph); err != nil {
+		log.Println("[WRITER] Error", err.Error())
+		return nil, false
+	}
+
+	color.Green("\n[crawl] Wrote %d artists and %d relations to %s", len(graph.Nodes), len(graph.Edges), path)
+	if len(failed) > 0 {
+		color.Yellow("    related artists could not be looked up for: %s", strings.Join(failed, ", "))
+	}
+	return graph, !interrupted
+}
+
+// crawlRelated walks the artists related to seeds breadth first, up to depth
+// steps away and until the graph holds maxArtists artists. It returns the
+// graph along with the artists whose related artists could not be looked
+// up, and whether stop was closed before the walk was done.
+func crawlRelated(ctx context.Context, client *spotify.Client, seeds []utils.FullArtist, depth, maxArtists int, stop <-chan struct{}) (*output.Graph, []string, bool) {
+	graph := &output.Graph{}
+	visited := make(map[string]bool)
+	var failed []string
+
+	type visit struct {
+		id    string
+		depth int
+	}
+	var queue []visit
+
+	add := func(artist utils.FullArtist, depth int) bool {
+		if visited[artist.Id] {
+			return true
+		}
+		if len(graph.Nodes) >= maxArtists {
+			return false
+		}
+		visited[artist.Id] = true
+		graph.Nodes = append(graph.Nodes, output.Node{
+			Id:         artist.Id,
+			Name:       artist.Name,
+			Depth:      depth,
+			Popularity: artist.Popularity,
+			Followers:  artist.Followers.Total,
+			Genres:     artist.Genres,
+		})
+		queue = append(queue, visit{artist.Id, depth})
+		return true
+	}
+
+	for _, seed := range seeds {
+		add(seed, 0)
+	}
+
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		if next.depth >= depth {
+			// The queue is in order of depth, everyone left is as deep
+			break
+		}
+		if len(graph.Nodes) >= maxArtists {
+			// No one else can be added, and related artists are only
+			// looked up to find more
+			break
+		}
+		if stopped(stop) {
+			return graph, failed, true
+		}
+
+		color.Cyan("[crawl] Getting artists related to %s (depth %d, %d artists found)", next.id, next.depth, len(graph.Nodes))
+		related, err := client.RelatedArtists(ctx, next.id)
+		if err != nil {
+			log.Println("[crawl] Error while fetching related artists", err.Error())
+			failed = append(failed, next.id)
+			continue
+		}
+
+		// Relations are only kept between artists in the graph
+		for _, artist := range related {
+			if add(artist, next.depth+1) {
+				graph.Edges = append(graph.Edges, output.Edge{Source: next.id, Target: artist.Id})
+			}
+		}
+	}
+	return graph, failed, false
+}
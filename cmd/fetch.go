@@ -1,21 +1,25 @@
 package cmd
 
 import (
-	"encoding/json"
+	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
-	"strconv"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/fatih/color"
-	"github.com/mitchellh/mapstructure"
-	"github.com/mohae/struct2csv"
+	"github.com/shashankgroovy/morag/output"
+	"github.com/shashankgroovy/morag/spotify"
 	"github.com/shashankgroovy/morag/utils"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // fetchCmd represents the fetch command
@@ -23,352 +27,1235 @@ var fetchCmd = &cobra.Command{
 	Use:   "fetch",
 	Short: "Fetches track information for an artist.",
 	Long: `Fetch helps you download the entire catalog/library of an artist (of
-your choice) from Spotify and save that in an output.csv file. A valid
+your choice) from Spotify and save that in an output file. A valid
 artistID or multiple artistIDs can be passed separated by space as
-arguments to this command.
+arguments to this command. Ids can also be read from a file, one per line,
+or from stdin by passing "-".
+
+Besides artistIDs, spotify:artist URIs, open.spotify.com links and plain
+artist names are accepted. Names are looked up with a search, and when more
+than one artist matches you get to pick the right one.
+
+All artists are written to one file with an artist column, or each to a
+file of its own with --split. The output is CSV unless another --format is
+picked: tsv, json (a single array), ndjson (an object per line) or sqlite
+(a database with tables for artists, albums and tracks that is updated in
+place when fetching again).
+
+CSV and TSV files hold every field of a track unless --columns picks some.
+Columns are dotted paths of JSON field names, like album.name or
+external_ids.isrc. Lists are indexed with artists[0].name or followed for
+every element, artists.name, and flattened into a cell with a policy after
+a colon: join (the default), first or count, as in available_markets:count.
+Sets of columns can be saved under a name in the config file and picked
+with --preset:
+
+  columns:
+    slim: [artist_id, id, name, album.name, "artists.name:join", external_ids.isrc]
+
+With --audio-features every row also holds the audio features of its track,
+under audio_features.danceability, audio_features.tempo and so on. The much
+larger audio analysis of each track is saved to a directory of its own with
+--audio-analysis.
+
+Rows only carry the album as it's embedded in a track. --album-details
+adds what the full album object tells: label, copyrights, genres,
+popularity and UPC, under album_details.label and so on. The albums
+themselves, one row each, are written to a file of their own with
+--albums-output.
+
+Spotify lists every album, single, compilation and appearance of an artist
+unless --groups picks some of them, and --market leaves out what isn't
+available in a country. The group of each album is recorded in the
+album.album_group column.
+
+With --market, or when the is_playable, restrictions or linked_from
+columns are picked, tracks are looked up in that market, or else your own
+country, so that Spotify relinks tracks unavailable there to a copy that
+is. The track originally listed is then named in linked_from. Every row
+tells whether the track can be played in that market (is_playable) and if
+not, why (restrictions.reason). Spotify then leaves out the markets tracks
+and albums are available in, so available_markets stays empty and the
+markets table of SQLite output is left as it was.
+
+Spotify returns the same recording many times over: regional editions,
+explicit and clean versions, deluxe re-issues. --dedup merges them into a
+row per recording, telling duplicates apart by track id, by ISRC, or by
+title and duration (title). Titles are compared without markers such as
+"(Remastered 2011)" or "- Deluxe Edition", but live takes, remixes and
+features are told apart. The row of the earliest release is kept and
+the ids of the others are listed in its alternate_ids column. Rows are
+then written once all tracks of an artist are in, and duplicates of rows
+written by an earlier run are not caught with --resume.
+
+--include-artist also writes the profiles of the fetched artists and of
+everyone credited on their tracks to <output>_artists.<format>, or to the
+artist tables when writing to SQLite.
+
+The items of a playlist are fetched the same way with the playlist
+subcommand, see morag fetch playlist --help.
 
 USAGE:
-$ morag fetch [artistID]
+$ morag fetch [artistID...]
+$ morag fetch playlist [playlistID...]
 
 EXAMPLE:
 $ morag fetch 0OdUWJ0sBjDrqHygGUXeCF
+$ morag fetch 0OdUWJ0sBjDrqHygGUXeCF 4Z8W4fKeB5YxbusRsdQVPb --split
+$ morag fetch "https://open.spotify.com/artist/0OdUWJ0sBjDrqHygGUXeCF?si=abc"
+$ morag fetch "Band of Horses"
+$ morag fetch 0OdUWJ0sBjDrqHygGUXeCF --format ndjson -o catalog.ndjson
+$ morag fetch 0OdUWJ0sBjDrqHygGUXeCF --format sqlite -o catalog.db
+$ morag fetch 0OdUWJ0sBjDrqHygGUXeCF --columns name,album.name,artists[0].name,available_markets:count
+$ morag fetch 0OdUWJ0sBjDrqHygGUXeCF --preset slim
+$ morag fetch 0OdUWJ0sBjDrqHygGUXeCF --audio-features --audio-analysis analysis/
+$ morag fetch 0OdUWJ0sBjDrqHygGUXeCF --album-details --albums-output albums.csv
+$ morag fetch 0OdUWJ0sBjDrqHygGUXeCF --include-artist
+$ morag fetch 0OdUWJ0sBjDrqHygGUXeCF --groups album,single --market US
+$ morag fetch 0OdUWJ0sBjDrqHygGUXeCF --dedup isrc
+$ morag fetch --from-file artists.txt
+$ cat artists.txt | morag fetch -
 `,
 	Run: fetch,
 }
 
+// fetchOptions holds what fetch is told by its flags, apart from where
+// to read artists from
+type fetchOptions struct {
+	outputOptions
+
+	concurrency      int
+	resume           bool
+	checkpointFile   string
+	split            bool
+	audioFeatures    bool
+	audioAnalysisDir string
+	albumDetails     bool
+	albumsOutput     string
+	includeArtist    bool
+	groups           []string
+	dedup            string
+}
+
+// defaultConcurrency is the number of workers fetch runs unless told
+// otherwise
+const defaultConcurrency = 4
+
+var fetchOpts fetchOptions
+var fromFile string
+
 func init() {
 	rootCmd.AddCommand(fetchCmd)
 
+	// Flags shared with the subcommands of fetch
+	addOutputFlags(fetchCmd, &fetchOpts.outputOptions, "output", output.Formats, "name,album.name,artists.name:join")
+	fetchCmd.PersistentFlags().StringVar(&fetchOpts.market, "market", "", "Look tracks up in this market, a country code such as US or from_token for your own, and only fetch albums available there")
+
 	// Add a local flag which will only run when this command
 	// is called directly.
-	// fetchCmd.Flags().StringP("output_csv", "o", "output.csv", "Provide an output file name of your choice")
+	fetchCmd.Flags().BoolVar(&fetchOpts.audioFeatures, "audio-features", false, "Add the audio features of every track (danceability, energy, tempo, ...) to its row")
+	fetchCmd.Flags().StringVar(&fetchOpts.audioAnalysisDir, "audio-analysis", "", "Save the audio analysis of every track as <trackID>.json in this directory")
+	fetchCmd.Flags().BoolVar(&fetchOpts.albumDetails, "album-details", false, "Add the label, copyrights, genres, popularity and UPC of the album to every row")
+	fetchCmd.Flags().StringVar(&fetchOpts.albumsOutput, "albums-output", "", "Also write every album, one row each, to this file")
+	fetchCmd.Flags().BoolVar(&fetchOpts.includeArtist, "include-artist", false, "Also write the profiles of the artists and their collaborators")
+	fetchCmd.Flags().StringSliceVar(&fetchOpts.groups, "groups", nil, "Only fetch albums of these groups: "+strings.Join(spotify.AlbumGroups, ", ")+" (default is all of them)")
+	fetchCmd.Flags().StringVar(&fetchOpts.dedup, "dedup", "", "Merge the tracks of an artist holding the same recording, by "+strings.Join(utils.DedupStrategies, ", "))
+	fetchCmd.Flags().IntVarP(&fetchOpts.concurrency, "concurrency", "c", defaultConcurrency, "Number of workers sending requests to Spotify")
+	fetchCmd.Flags().BoolVar(&fetchOpts.resume, "resume", false, "Skip the work recorded in the checkpoint and append only new rows to the output")
+	fetchCmd.Flags().StringVarP(&fromFile, "from-file", "f", "", "Read artistIDs from a file, one per line (use - for stdin)")
+	fetchCmd.Flags().BoolVar(&fetchOpts.split, "split", false, "Write every artist to a file of its own instead of one merged file")
+	fetchCmd.Flags().StringVar(&fetchOpts.checkpointFile, "checkpoint", "", "Checkpoint file recording completed work (default is the output file with a .checkpoint suffix)")
 }
 
 func fetch(cmd *cobra.Command, args []string) {
-	if len(args) < 1 {
+	inputs, err := readArtistInputs(args, fromFile)
+	if err != nil {
+		log.Println("Error while reading artistIDs", err.Error())
+		return
+	}
+
+	if len(inputs) < 1 {
 		// Print error, help text and exit
 		fmt.Printf("\nERROR: Please provide a Spotify artistID.\n\n")
 		cmd.Help()
-	} else {
-		artistID := args[0]
-		var MAX_LIMIT = 50
+		return
+	}
 
-		// check if a user is already authenticated
-		if authToken, err := utils.TestAndSetToken(); err != nil {
-			log.Println("Error while setting the auth token", err.Error())
-		} else {
+	fetchArtists(inputs, fetchOpts)
+}
 
-			// create some channels for data exchange
-			albumCh := make(chan string)
-			trackCh := make(chan string)
-			// retry channel to stop creating more goroutines as soon as a rate limit is hit
-			retryCh := make(chan time.Duration)
+// fetchArtists fetches the catalogs of the artists given by inputs and
+// writes them out as opts tell
+func fetchArtists(inputs []string, opts fetchOptions) {
+	var err error
+	opts.market, err = checkAlbumFilters(opts.groups, opts.market)
+	if err != nil {
+		log.Println("Error in album filters", err.Error())
+		return
+	}
 
-			var songlist []utils.FullSoundtrack
-			var mu sync.Mutex
+	if err := checkDedup(opts.dedup); err != nil {
+		log.Println("Error in dedup strategy", err.Error())
+		return
+	}
 
-			var wg sync.WaitGroup
+	columns, err := pickColumns(opts.format, opts.preset, opts.columns, utils.CatalogRow{})
+	if err != nil {
+		log.Println("Error while picking columns", err.Error())
+		return
+	}
+	pickedColumns := columns
+	if columns == nil && output.Tabular(opts.format) {
+		columns = opts.catalogColumns()
+	}
 
-			// paginate this
-			go getAlbums(authToken, artistID, albumCh, 0, MAX_LIMIT)
+	// check if a user is already authenticated
+	authToken, err := utils.TestAndSetToken()
+	if err != nil {
+		log.Println("Error while setting the auth token", err.Error())
+		return
+	}
 
-			albumNum := 0
+	ctx, stop, release := watchInterrupts()
+	defer release()
 
-			for albumId := range albumCh {
-				select {
-				case sleep := <-retryCh:
-					// Pause go routine creation untill cooldown
-					time.Sleep(sleep * time.Millisecond)
-				default:
-					// do nothing
-				}
-				wg.Add(1)
-				albumNum += 1
-				color.Yellow("[albumNum]" + string(fmt.Sprintf("%d", albumNum)))
-				go getAlbumTracks(authToken, albumId, trackCh, retryCh, &wg)
-			}
+	if opts.concurrency < 1 {
+		opts.concurrency = 1
+	}
 
-			trackNum := 0
-			for trackId := range trackCh {
-				select {
-				case sleep := <-retryCh:
-					// Pause go routine creation untill cooldown
-					// Time to write things to csv
-					WritetoCSV(songlist)
-
-					time.Sleep(sleep * time.Millisecond)
-				default:
-					// do nothing
-				}
-				trackNum += 1
-				color.Yellow("[trackNum]" + string(fmt.Sprintf("%d", trackNum)))
-				wg.Add(1)
-				go getFullSoundTrack(authToken, trackId, &songlist, retryCh, &wg, &mu)
+	// A single limiter is shared by every worker, so a 429 seen by one of
+	// them pauses all of them
+	client := spotify.NewClient(authToken.AccessToken)
+	client.Limiter = spotify.NewLimiter(opts.rate, opts.concurrency)
+	client.OnRateLimit = func(cooldown time.Duration) {
+		color.Red("[fetch] Rate limited, pausing all workers for %s", cooldown)
+	}
+
+	// Turn URIs, links and names into artistIDs
+	artistIDs := resolveArtists(ctx, client, inputs)
+	if len(artistIDs) < 1 {
+		color.Red("None of the given artists could be found")
+		return
+	}
+
+	// Tracks looked up in a market are relinked to copies playable there
+	// and tell which are not, but lose their available_markets
+	playMarket := playabilityMarket(ctx, client, opts.market, pickedColumns)
+	if playMarket != "" {
+		color.Green("[fetch] Checking playability in %s", playMarket)
+	}
+
+	// The checkpoint journal keeps track of completed albums and tracks so
+	// that an aborted run can be picked up with --resume
+	if opts.checkpointFile == "" {
+		opts.checkpointFile = outputFileFor(opts.file, opts.format) + ".checkpoint"
+	}
+	checkpoint, err := utils.OpenCheckpoint(opts.checkpointFile, opts.resume)
+	if err != nil {
+		log.Println("Error while opening the checkpoint file", err.Error())
+		return
+	}
+	defer checkpoint.Close()
+
+	if opts.resume {
+		color.Green("Resuming, %d tracks were fetched by previous runs", checkpoint.Tracks())
+	}
+
+	if opts.audioAnalysisDir != "" {
+		if err := os.MkdirAll(opts.audioAnalysisDir, 0755); err != nil {
+			log.Println("Error while creating the audio analysis directory", err.Error())
+			return
+		}
+	}
+
+	// A merged output stays open for all artists, split outputs are opened
+	// one artist at a time
+	outputOptions := output.Options{Append: opts.resume, Columns: columns}
+	var merged *rowWriter
+	if !opts.split {
+		w, err := output.Create(opts.format, opts.outputPath(""), outputOptions)
+		if err != nil {
+			log.Println("[WRITER] Cannot create file", err)
+			return
+		}
+		merged = startWriter(w, opts.dedup)
+	}
+
+	// Albums all go to a single file, whether split or not
+	var albums *rowWriter
+	if opts.albumsOutput != "" {
+		w, err := output.Create(opts.format, opts.albumsOutput, output.Options{Append: opts.resume})
+		if err != nil {
+			log.Println("[WRITER] Cannot create file", err)
+			return
+		}
+		albums = startWriter(w, "")
+	}
+
+	// The fetched artists come first in the artist table, their
+	// collaborators are added as their tracks come in
+	var credited *artistSet
+	if opts.includeArtist {
+		credited = &artistSet{}
+		credited.add(artistIDs...)
+	}
+
+	var summaries []artistSummary
+	interrupted := false
+	lost := 0
+
+	for i, artistID := range artistIDs {
+		if stopped(stop) {
+			summaries = append(summaries, artistSummary{ArtistID: artistID, Status: "skipped"})
+			continue
+		}
+
+		path := opts.outputPath(artistID)
+		writer := merged
+		if writer == nil {
+			w, err := output.Create(opts.format, path, outputOptions)
+			if err != nil {
+				log.Println("[WRITER] Cannot create file", err)
+				summaries = append(summaries, artistSummary{ArtistID: artistID, Status: "failed", OutputFile: path, Err: err})
+				continue
 			}
+			writer = startWriter(w, opts.dedup)
+		}
+
+		color.Green("\n[fetch] Fetching artist %s (%d of %d)", artistID, i+1, len(artistIDs))
+		p := &pipeline{
+			client:      client,
+			workers:     opts.concurrency,
+			stop:        stop,
+			checkpoint:  checkpoint.Artist(artistID),
+			writer:      writer,
+			albums:      albums,
+			credited:    credited,
+			groups:      opts.groups,
+			market:      opts.market,
+			playMarket:  playMarket,
+			details:     opts.albumDetails,
+			features:    opts.audioFeatures,
+			analysisDir: opts.audioAnalysisDir,
+		}
+		result := p.fetchCatalog(ctx, artistID)
+		interrupted = interrupted || result.Interrupted
+		lost += len(result.Tracks.Failed)
+
+		// Rows are written as they come in, wait for the last of them
+		// before taking stock
+		var writeErr error
+		if writer == merged {
+			writer.Sync()
+			writeErr = writer.Err()
+		} else {
+			writeErr = writer.Close()
+		}
 
-			wg.Wait()
+		summary := summarize(artistID, path, result, writer.Rows(artistID), writeErr)
+		summary.Market = playMarket
+		summaries = append(summaries, summary)
+	}
+
+	if merged != nil {
+		merged.Close()
+	}
+	if albums != nil {
+		albums.Close()
+	}
 
-			WritetoCSV(songlist)
+	if credited != nil && !stopped(stop) {
+		writeCredited(ctx, client, opts, credited.list(), stop)
+	}
+
+	if interrupted {
+		color.Red("\nInterrupted, saved the tracks fetched so far")
+	} else {
+		fmt.Println("\nFinished")
+	}
+	printSummary(summaries)
 
-			fmt.Println("Finished")
-			fmt.Println("Output stored at - ", os.Getenv("OUTPUT_FILE"))
+	if interrupted || lost > 0 {
+		if lost > 0 {
+			color.Red("%d tracks could not be looked up and are missing from the output", lost)
 		}
+		color.Red("Run the same command with --resume to pick up where this run stopped")
+		checkpoint.Close()
+		release()
+		os.Exit(exitPartial)
 	}
 }
 
-// getAlbums returns the result of getting an album
-func getAlbums(authToken utils.OAuthToken, artistID string, albumCh chan<- string, offset, limit int) {
-	color.Yellow("[getAlbums] get albums")
-	defer close(albumCh)
-
-	var (
-		albums []interface{}
-		result map[string]interface{}
-	)
+// artistSummary is the outcome of fetching a single artist
+type artistSummary struct {
+	ArtistID   string
+	Status     string
+	Albums     albumStats
+	Tracks     int
+	Expected   int
+	Rows       int
+	OutputFile string
+	Incomplete []string
+	Failed     int
+	Err        error
+
+	// Market is where Unplayable tracks can't be played and Relinked ones
+	// were swapped for a copy that can
+	Market     string
+	Unplayable int
+	Relinked   int
+	Reasons    map[string]int
+}
 
-	// Create a new http client
-	client := &http.Client{}
-	// a basic flag to safe guard process execution. It's helpful when rate limit is hit
-	proceed := true
+// summarize works out how fetching an artist went
+func summarize(artistID, outputFile string, result *catalog, rows int, writeErr error) artistSummary {
+	summary := artistSummary{
+		ArtistID:   artistID,
+		Status:     "ok",
+		Albums:     result.Albums,
+		Tracks:     result.Tracks.Fetched,
+		Expected:   result.Tracks.Total,
+		Rows:       rows,
+		OutputFile: outputFile,
+		Incomplete: result.Tracks.Incomplete,
+		Failed:     len(result.Tracks.Failed),
+		Err:        result.Albums.Err,
+		Unplayable: result.Playability.Unplayable,
+		Relinked:   result.Playability.Relinked,
+		Reasons:    result.Playability.Reasons,
+	}
 
-	// Construct the http request
-	spotifyURL := fmt.Sprintf("https://api.spotify.com/v1/artists/%s/albums", artistID)
-	req, _ := http.NewRequest("GET", spotifyURL, nil)
-	req.Header.Add("Authorization", "Bearer "+authToken.AccessToken)
+	switch {
+	case writeErr != nil:
+		summary.Status = "failed"
+		summary.Err = writeErr
+	case result.Albums.Err != nil && result.Albums.Fetched == 0:
+		summary.Status = "failed"
+	case result.Interrupted:
+		summary.Status = "interrupted"
+	case result.Albums.Err != nil || len(result.Tracks.Incomplete) > 0 || len(result.Tracks.Failed) > 0:
+		summary.Status = "incomplete"
+	}
+	return summary
+}
 
-	// Add the pagination query parameters
-	q := req.URL.Query()
-	q.Add("offset", string(fmt.Sprintf("%d", offset)))
-	q.Add("limit", string(fmt.Sprintf("%d", limit)))
-	req.URL.RawQuery = q.Encode()
+// printSummary prints a line per artist telling how the fetch went
+func printSummary(summaries []artistSummary) {
+	fmt.Println("\nSummary")
+	for _, s := range summaries {
+		line := fmt.Sprintf("%-24s %-12s albums %d/%d  tracks %d/%d  rows %d  %s",
+			s.ArtistID, s.Status, s.Albums.Fetched, s.Albums.Total, s.Tracks, s.Expected, s.Rows, s.OutputFile)
+		if s.Err != nil {
+			line += "  (" + s.Err.Error() + ")"
+		}
 
-	// Fire it away
-	color.Yellow("[getAlbums] Fetching albums of artist")
-	fmt.Println(req.URL.String())
-	resp, err := client.Do(req)
+		switch s.Status {
+		case "ok":
+			color.Green(line)
+		case "failed":
+			color.Red(line)
+		default:
+			color.Yellow(line)
+		}
+		if len(s.Incomplete) > 0 {
+			color.Red("    albums with missing tracks: %s", strings.Join(s.Incomplete, ", "))
+		}
+		if s.Failed > 0 {
+			color.Red("    tracks that could not be looked up: %d", s.Failed)
+		}
+		if s.Relinked > 0 {
+			color.Yellow("    relinked to copies playable in %s: %d", s.Market, s.Relinked)
+		}
+		if s.Unplayable > 0 {
+			var reasons []string
+			for reason, n := range s.Reasons {
+				reasons = append(reasons, fmt.Sprintf("%s %d", reason, n))
+			}
+			sort.Strings(reasons)
+			color.Yellow("    not playable in %s: %d (%s)", s.Market, s.Unplayable, strings.Join(reasons, ", "))
+		}
+	}
+}
 
-	// check if everything's ok
-	if err != nil {
-		log.Println("Error in request", err.Error())
+// readArtistInputs gathers the artists passed as arguments and those listed
+// in fromFile, one per line. A "-" in place of either reads the artists from
+// stdin instead. Blank lines and lines starting with # are skipped. A line may
+// also hold several ids, URIs or links separated by spaces.
+func readArtistInputs(args []string, fromFile string) ([]string, error) {
+	var inputs []string
+	seen := make(map[string]bool)
+	add := func(input string) {
+		if input != "" && !seen[input] {
+			seen[input] = true
+			inputs = append(inputs, input)
+		}
 	}
 
-	if resp.StatusCode == http.StatusTooManyRequests {
-		proceed = false
-		log.Println("[getAlbums] 429", resp.StatusCode, resp.Header.Get("Retry-After"))
-		retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+	sources := []string{}
+	for _, arg := range args {
+		if arg == "-" {
+			sources = append(sources, arg)
+		} else {
+			add(strings.TrimSpace(arg))
+		}
+	}
+	if fromFile != "" {
+		sources = append(sources, fromFile)
+	}
 
-		// Start the retry mechanism
-		retry := utils.RetryRequest{Attempt: 1, Min: 1, Max: 5}
-		retry.Backoff(retryAfter)
+	for _, source := range sources {
+		var r io.Reader = os.Stdin
+		if source != "-" {
+			file, err := os.Open(source)
+			if err != nil {
+				return nil, err
+			}
+			defer file.Close()
+			r = file
+		}
 
-		//Execute this request again
-		for retry.Attempt < retry.Max {
-			retry.Attempt += 1
-			time.Sleep(retry.Duration * time.Second)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if strings.HasPrefix(line, "#") {
+				continue
+			}
 
-			// fire the request
-			resp, err = client.Do(req)
-			if resp.StatusCode != http.StatusTooManyRequests {
-				proceed = true
-				break
+			// Names may contain spaces, so a line is only split up when
+			// every part of it is an id, URI or link
+			fields := strings.Fields(line)
+			split := true
+			for _, field := range fields {
+				if _, err := spotify.ParseID("artist", field); err != nil {
+					split = false
+					break
+				}
+			}
+			if !split {
+				add(line)
+				continue
 			}
+			for _, field := range fields {
+				add(field)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
 		}
-	} else if resp.StatusCode != http.StatusOK {
-		body, _ := ioutil.ReadAll(resp.Body)
-		fmt.Println("Error ", resp.StatusCode, string(body))
 	}
-	defer resp.Body.Close()
+	return inputs, nil
+}
 
-	if proceed {
-		err = json.NewDecoder(resp.Body).Decode(&result)
-		if err != nil {
-			log.Println("Could not parse JSON response. ", err.Error())
+// outputPath returns the file an artist's rows are written to: the output
+// file, or with --split a file of its own named after the artist
+func (o fetchOptions) outputPath(artistID string) string {
+	path := outputFileFor(o.file, o.format)
+	if !o.split {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "_" + artistID + ext
+}
+
+// catalog tells how fetching an artist went, the tracks themselves go
+// straight to the writer
+type catalog struct {
+	Albums      albumStats
+	Tracks      trackStats
+	Playability playStats
+
+	// Interrupted is set when the run was stopped before it could finish
+	Interrupted bool
+}
+
+// pipeline holds what every stage of the fetch pipeline shares
+type pipeline struct {
+	client  *spotify.Client
+	workers int
+
+	// stop is closed once no new requests should be sent
+	stop <-chan struct{}
+
+	// checkpoint, if set, records completed work so that stages can skip
+	// whatever a previous run already did
+	checkpoint *utils.ArtistCheckpoint
+
+	// writer receives the tracks as they are fetched
+	writer *rowWriter
+
+	// albums, if set, receives the albums as they are looked up
+	albums *rowWriter
+
+	// credited, if set, collects the artists credited on every track
+	credited *artistSet
+
+	// groups and market narrow down the albums listed for the artist
+	groups []string
+	market string
+
+	// playMarket is the market albums and tracks are looked up in, which
+	// their playability and relinking refer to
+	playMarket string
+
+	// details adds the details of the album to every row. They are kept
+	// by album id until the album's tracks come back, along with the group
+	// of every listed album.
+	details      bool
+	albumMu      sync.Mutex
+	albumDetails map[string]*utils.AlbumDetails
+	albumGroups  map[string]string
+
+	// features adds the audio features of every track to its row
+	features bool
+
+	// analysisDir, if set, is where the audio analysis of every track is
+	// saved
+	analysisDir string
+}
+
+// fetchCatalog runs the fetch pipeline for an artist: albums are listed,
+// looked up in batches to find their tracks, and the tracks are then looked
+// up in batches as well. Every stage after the album listing runs on a pool
+// of workers.
+//
+// Once p.stop is closed no new requests are sent, the stages drain what is
+// already queued and fetchCatalog returns what was gathered until then.
+// Canceling ctx drops the requests in flight as well.
+func (p *pipeline) fetchCatalog(ctx context.Context, artistID string) *catalog {
+	var result catalog
+
+	// create some channels for data exchange
+	albumCh := make(chan utils.SimplifiedAlbum)
+	albumBatchCh := make(chan []utils.SimplifiedAlbum)
+	trackCh := make(chan string)
+	trackBatchCh := make(chan []string)
+
+	go p.getAlbums(ctx, artistID, albumCh, &result.Albums)
+	go batchAlbums(albumCh, albumBatchCh)
+	go p.batchTracks(trackCh, trackBatchCh)
+
+	// Album workers list the tracks of a batch of albums. trackCh is closed
+	// once all of them are done.
+	var albumWg sync.WaitGroup
+	for i := 0; i < p.workers; i++ {
+		albumWg.Add(1)
+		go func() {
+			defer albumWg.Done()
+			for batch := range albumBatchCh {
+				p.getAlbumBatch(ctx, artistID, batch, trackCh, &result.Tracks)
+			}
+		}()
+	}
+	go func() {
+		albumWg.Wait()
+		close(trackCh)
+	}()
+
+	// Track workers retrieve the full soundtracks of a batch of tracks
+	var wg sync.WaitGroup
+	for i := 0; i < p.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range trackBatchCh {
+				p.getFullSoundTracks(ctx, artistID, batch, &result.Tracks, &result.Playability)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	result.Interrupted = stopped(p.stop) || ctx.Err() != nil
+
+	return &result
+}
+
+// albumStats keeps track of how much of a discography was retrieved
+type albumStats struct {
+	Total   int
+	Fetched int
+
+	// Err is the error that cut the listing short, if any
+	Err error
+}
+
+// getAlbums walks every page of an artist's albums and sends each album on
+// albumCh. Once the pages run out, stats holds the total number of albums
+// reported by Spotify and the number actually fetched.
+func (p *pipeline) getAlbums(ctx context.Context, artistID string, albumCh chan<- utils.SimplifiedAlbum, stats *albumStats) {
+	color.Yellow("[getAlbums] get albums")
+	defer close(albumCh)
 
+	opt := &spotify.Options{Limit: spotify.MaxLimit, Market: p.market, IncludeGroups: p.groups}
+
+	for !stopped(p.stop) {
+		// Fire it away
+		color.Yellow("[getAlbums] Fetching albums of artist")
+		page, err := p.client.ArtistAlbums(ctx, artistID, opt)
+		if err != nil {
+			// Without this page there is no way to reach the following ones
+			log.Println("[getAlbums] Error in request", err.Error())
+			stats.Err = err
+			break
 		}
+		stats.Total = page.Total
+
 		// Store all albums from request
-		albums = result["items"].([]interface{})
-		for _, value := range albums {
-			var album utils.SimplifiedAlbum
-			mapstructure.Decode(value, &album)
-			albumCh <- album.Id
+		for _, album := range page.Items {
+			stats.Fetched += 1
+			p.keepGroup(album.Id, album.AlbumGroup)
+			albumCh <- album
+		}
+
+		// `next` is null on the last page
+		if page.Next == "" || len(page.Items) == 0 {
+			break
 		}
+		opt.Offset += len(page.Items)
+	}
+
+	if stats.Fetched < stats.Total {
+		color.Red("[getAlbums] Fetched only %d of %d albums", stats.Fetched, stats.Total)
+	} else {
+		color.Green("[getAlbums] Fetched %d of %d albums", stats.Fetched, stats.Total)
 	}
 }
 
-// getAlbumTracks fetches all the tracks of an album
-func getAlbumTracks(authToken utils.OAuthToken, albumId string, trackCh chan<- string, retryCh chan<- time.Duration, wg *sync.WaitGroup) {
-	defer wg.Done()
+// trackStats compares the number of tracks listed for every album against
+// the album's total_tracks, and keeps the tracks that could not be looked up
+type trackStats struct {
+	sync.Mutex
+	Total      int
+	Fetched    int
+	Incomplete []string
+	Failed     []string
+}
 
-	var (
-		tracks []interface{}
-		result map[string]interface{}
-	)
+// add records the tracks listed for an album and flags the album when some
+// are missing
+func (s *trackStats) add(albumID string, totalTracks, fetched int) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.Total += totalTracks
+	s.Fetched += fetched
+	if fetched < totalTracks {
+		s.Incomplete = append(s.Incomplete, albumID)
+		color.Red("[getAlbumTracks] Album %s has %d tracks, only %d fetched", albumID, totalTracks, fetched)
+	}
+}
 
-	offset := 0
-	MAX_LIMIT := 50
+// fail records tracks whose lookup failed, so they are missing from the
+// output
+func (s *trackStats) fail(trackIDs []string) {
+	s.Lock()
+	defer s.Unlock()
 
-	// Create a new http client
-	client := &http.Client{}
+	s.Failed = append(s.Failed, trackIDs...)
+}
 
-	// a basic flag to safe guard process execution. It's helpful when rate limit is hit
-	proceed := true
+// playStats counts the tracks that can't be played in the market they were
+// looked up in, by reason, and those relinked to another copy
+type playStats struct {
+	sync.Mutex
+	Unplayable int
+	Relinked   int
+	Reasons    map[string]int
+}
 
-	// Construct the http request
-	spotifyURL := fmt.Sprintf("https://api.spotify.com/v1/albums/%s/tracks", albumId)
-	req, _ := http.NewRequest("GET", spotifyURL, nil)
-	req.Header.Add("Authorization", "Bearer "+authToken.AccessToken)
+// add records the playability of a track
+func (s *playStats) add(track utils.FullSoundtrack) {
+	s.Lock()
+	defer s.Unlock()
 
-	// Add the pagination query parameters
-	q := req.URL.Query()
-	q.Add("offset", string(fmt.Sprintf("%d", offset)))
-	q.Add("limit", string(fmt.Sprintf("%d", MAX_LIMIT)))
-	req.URL.RawQuery = q.Encode()
+	if track.LinkedFrom != nil && track.LinkedFrom.Id != track.Id {
+		s.Relinked++
+	}
+	if track.IsPlayable != nil && !*track.IsPlayable {
+		s.Unplayable++
+		reason := "unknown"
+		if track.Restrictions != nil && track.Restrictions.Reason != "" {
+			reason = track.Restrictions.Reason
+		}
+		if s.Reasons == nil {
+			s.Reasons = make(map[string]int)
+		}
+		s.Reasons[reason]++
+	}
+}
 
-	// Fire it away
-	color.Cyan("\n[getAlbumTracks] Getting tracks for")
-	fmt.Println(req.URL.String())
-	resp, err := client.Do(req)
+// batchAlbums groups the albums coming in on albumCh into batches of up to
+// spotify.MaxAlbumIDs, the most /albums?ids= takes at once
+func batchAlbums(albumCh <-chan utils.SimplifiedAlbum, batchCh chan<- []utils.SimplifiedAlbum) {
+	defer close(batchCh)
+
+	albumNum := 0
+	batch := make([]utils.SimplifiedAlbum, 0, spotify.MaxAlbumIDs)
+	for album := range albumCh {
+		albumNum += 1
+		color.Yellow("[albumNum]" + string(fmt.Sprintf("%d", albumNum)))
+		batch = append(batch, album)
+		if len(batch) == spotify.MaxAlbumIDs {
+			batchCh <- batch
+			batch = make([]utils.SimplifiedAlbum, 0, spotify.MaxAlbumIDs)
+		}
+	}
+	if len(batch) > 0 {
+		batchCh <- batch
+	}
+}
 
-	// check if everything's ok
-	if err != nil {
-		log.Println("Error in request", err.Error())
+// batchTracks groups the track ids coming in on trackCh into batches of up to
+// spotify.MaxTrackIDs, the most /tracks?ids= takes at once. Tracks already
+// written by a previous run are left out.
+func (p *pipeline) batchTracks(trackCh <-chan string, batchCh chan<- []string) {
+	defer close(batchCh)
+
+	trackNum := 0
+	batch := make([]string, 0, spotify.MaxTrackIDs)
+	for trackId := range trackCh {
+		if p.checkpoint != nil && p.checkpoint.TrackDone(trackId) {
+			continue
+		}
+		trackNum += 1
+		color.Yellow("[trackNum]" + string(fmt.Sprintf("%d", trackNum)))
+		batch = append(batch, trackId)
+		if len(batch) == spotify.MaxTrackIDs {
+			batchCh <- batch
+			batch = make([]string, 0, spotify.MaxTrackIDs)
+		}
+	}
+	if len(batch) > 0 {
+		batchCh <- batch
 	}
+}
 
-	if resp.StatusCode == http.StatusTooManyRequests {
-		proceed = false
-		log.Println("[getAlbumTracks] 429", resp.StatusCode, resp.Header.Get("Retry-After"))
-		retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+// getAlbumBatch looks up a batch of albums through /albums?ids= and sends the
+// ids of all their tracks on trackCh. Albums listed by a previous run are
+// taken from the checkpoint instead, and only looked up when their details
+// are wanted.
+func (p *pipeline) getAlbumBatch(ctx context.Context, artistID string, batch []utils.SimplifiedAlbum, trackCh chan<- string, stats *trackStats) {
+	// Skip the request once stopped, the batch is only drained
+	if stopped(p.stop) {
+		return
+	}
 
-		// Start the retry mechanism
-		retry := utils.RetryRequest{Attempt: 1, Min: 1, Max: 5}
-		retry.Backoff(retryAfter)
-		retryCh <- retry.Duration
+	listed := make(map[string][]string)
+	var ids []string
+	for _, album := range batch {
+		if trackIDs, ok := p.checkpointAlbum(album.Id); ok {
+			listed[album.Id] = trackIDs
+			if !p.details && p.albums == nil {
+				continue
+			}
+		}
+		ids = append(ids, album.Id)
+	}
 
-		//Execute this request again
-		for retry.Attempt < retry.Max {
-			retry.Attempt += 1
-			time.Sleep(retry.Duration * time.Second)
+	found := make(map[string]bool, len(ids))
+	if len(ids) > 0 {
+		// Fire it away
+		color.Cyan("\n[getAlbumBatch] Getting %d albums", len(ids))
+		albums, err := p.client.Albums(ctx, ids, p.playMarket)
+		if err != nil {
+			log.Println("[getAlbumBatch] Error in request", err.Error())
+		}
 
-			// fire the request
-			resp, err = client.Do(req)
-			if resp.StatusCode != http.StatusTooManyRequests {
-				proceed = true
-				break
+		// The details are kept before any track is sent on, so they are
+		// there by the time the tracks come back
+		for _, album := range albums {
+			_, done := listed[album.Id]
+			found[album.Id] = true
+			p.keepAlbum(artistID, album, !done)
+		}
+		for _, album := range albums {
+			if _, ok := listed[album.Id]; !ok {
+				p.getAlbumTracks(ctx, album, trackCh, stats)
 			}
 		}
-	} else if resp.StatusCode != http.StatusOK {
-		body, _ := ioutil.ReadAll(resp.Body)
-		fmt.Println("Error ", resp.StatusCode, string(body))
 	}
-	defer resp.Body.Close()
 
-	if proceed {
-		err = json.NewDecoder(resp.Body).Decode(&result)
-		if err != nil {
-			log.Println("Could not parse JSON response. ", err.Error())
+	for _, album := range batch {
+		if trackIDs, ok := listed[album.Id]; ok {
+			for _, id := range trackIDs {
+				trackCh <- id
+			}
+			stats.add(album.Id, album.TotalTracks, len(trackIDs))
+		} else if !found[album.Id] {
+			// Whatever did not come back can't be listed, count it as
+			// missing
+			stats.add(album.Id, album.TotalTracks, 0)
+		}
+	}
+}
 
+// keepAlbum holds on to the details of an album for the rows of its tracks
+// and writes it to the albums output. Albums written by a previous run are
+// not written again.
+func (p *pipeline) keepAlbum(artistID string, album utils.FullAlbum, write bool) {
+	if p.details {
+		p.albumMu.Lock()
+		if p.albumDetails == nil {
+			p.albumDetails = make(map[string]*utils.AlbumDetails)
 		}
-		// Store all tracks from request
-		tracks = result["items"].([]interface{})
-		for _, value := range tracks {
-			var soundtrack utils.SimplifiedSoundtrack
-			mapstructure.Decode(value, &soundtrack)
-			trackCh <- soundtrack.Id
+		details := album.AlbumDetails
+		p.albumDetails[album.Id] = &details
+		p.albumMu.Unlock()
+	}
+
+	if p.albums != nil && write {
+		row := utils.AlbumRow{
+			ArtistId:        artistID,
+			SimplifiedAlbum: album.SimplifiedAlbum,
+			AlbumDetails:    album.AlbumDetails,
 		}
+		row.AlbumGroup = p.groupOf(album.Id)
+		p.albums.Send(rowBatch{source: artistID, rows: []interface{}{row}})
+	}
+}
 
+// detailsOf returns the details kept for an album, if any
+func (p *pipeline) detailsOf(albumID string) *utils.AlbumDetails {
+	p.albumMu.Lock()
+	defer p.albumMu.Unlock()
+	return p.albumDetails[albumID]
+}
+
+// keepGroup remembers how a listed album relates to the artist
+func (p *pipeline) keepGroup(albumID, group string) {
+	p.albumMu.Lock()
+	defer p.albumMu.Unlock()
+	if p.albumGroups == nil {
+		p.albumGroups = make(map[string]string)
 	}
+	p.albumGroups[albumID] = group
 }
 
-// getFullSoundTrack retrieves a list of full soundtracks
-func getFullSoundTrack(authToken utils.OAuthToken, trackId string, songlist *[]utils.FullSoundtrack, retryCh chan<- time.Duration, wg *sync.WaitGroup, mu *sync.Mutex) {
-	var soundtrack utils.FullSoundtrack
+// groupOf returns the group an album was listed under: album, single,
+// compilation or appears_on
+func (p *pipeline) groupOf(albumID string) string {
+	p.albumMu.Lock()
+	defer p.albumMu.Unlock()
+	return p.albumGroups[albumID]
+}
 
-	// Create a new http client
-	client := &http.Client{}
+// checkpointAlbum returns the track ids a checkpoint holds for an album
+func (p *pipeline) checkpointAlbum(albumID string) ([]string, bool) {
+	if p.checkpoint == nil {
+		return nil, false
+	}
+	return p.checkpoint.Album(albumID)
+}
 
-	// a basic flag to safe guard process execution. It's helpful when rate limit is hit
-	proceed := true
+// getAlbumTracks sends the ids of an album's tracks on trackCh. The first
+// page comes embedded in the full album object, any following pages are
+// fetched from /albums/{id}/tracks. Albums that end up with fewer tracks than
+// their total_tracks are recorded in stats, fully listed albums in the
+// checkpoint.
+func (p *pipeline) getAlbumTracks(ctx context.Context, album utils.FullAlbum, trackCh chan<- string, stats *trackStats) {
+	var trackIDs []string
+	page := &album.Tracks
+	opt := &spotify.Options{Limit: spotify.MaxLimit}
+	listed := false
+
+	for {
+		// Store all tracks from the page
+		for _, soundtrack := range page.Items {
+			trackIDs = append(trackIDs, soundtrack.Id)
+			trackCh <- soundtrack.Id
+		}
 
-	// Construct the http request
-	spotifyURL := fmt.Sprintf("https://api.spotify.com/v1/tracks/%s", trackId)
-	req, _ := http.NewRequest("GET", spotifyURL, nil)
-	req.Header.Add("Authorization", "Bearer "+authToken.AccessToken)
+		// `next` is null on the last page
+		if page.Next == "" || len(page.Items) == 0 {
+			listed = true
+			break
+		}
+		if stopped(p.stop) {
+			break
+		}
+		opt.Offset += len(page.Items)
 
-	// Add the pagination query parameters
-	q := req.URL.Query()
-	//q.Add("ids", string(fmt.Sprintf("%s", trackList)))
-	req.URL.RawQuery = q.Encode()
+		// Fire it away
+		color.Cyan("\n[getAlbumTracks] Getting more tracks for %s", album.Id)
+		var err error
+		page, err = p.client.AlbumTracks(ctx, album.Id, opt)
+		if err != nil {
+			log.Println("[getAlbumTracks] Error in request", err.Error())
+			break
+		}
+	}
 
-	// Fire it away
-	color.Red("Fetching soundtrack")
-	fmt.Println(req.URL.String())
-	resp, err := client.Do(req)
+	// Check that the album came back complete
+	stats.add(album.Id, album.TotalTracks, len(trackIDs))
 
-	// check if everything's ok
-	if err != nil {
-		log.Println("Error in request", err.Error())
+	if listed && p.checkpoint != nil {
+		if err := p.checkpoint.RecordAlbum(album.Id, trackIDs); err != nil {
+			log.Println("[getAlbumTracks] Could not write checkpoint", err.Error())
+		}
 	}
+}
 
-	if resp.StatusCode == http.StatusTooManyRequests {
-		proceed = false
-		log.Println("[getFullSoundTrack] 429", resp.StatusCode, resp.Header.Get("Retry-After"))
-		retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+// getFullSoundTracks retrieves the full soundtracks of a batch of tracks
+// through /tracks?ids= and hands them to the writer. A batch that can't be
+// looked up is recorded in tracks, how many can be played in stats.
+func (p *pipeline) getFullSoundTracks(ctx context.Context, artistID string, trackIds []string, tracks *trackStats, stats *playStats) {
+	// Skip the request once stopped, the batch is only drained
+	if stopped(p.stop) {
+		return
+	}
 
-		// Start the retry mechanism
-		retry := utils.RetryRequest{Attempt: 1, Min: 1, Max: 5}
-		retry.Backoff(retryAfter)
-		retryCh <- retry.Duration
+	// Fire it away
+	color.Red("Fetching %d soundtracks", len(trackIds))
+	soundtracks, err := p.client.Tracks(ctx, trackIds, p.playMarket)
+	if err != nil {
+		log.Println("[getFullSoundTracks] Error in request", err.Error())
+		tracks.fail(trackIds)
+		return
+	}
 
-		//Execute this request again
-		for retry.Attempt < retry.Max {
-			retry.Attempt += 1
-			time.Sleep(retry.Duration * time.Second)
+	var features map[string]*utils.AudioFeatures
+	if p.features {
+		features = p.getAudioFeatures(ctx, soundtracks)
+	}
+	if p.analysisDir != "" {
+		p.saveAudioAnalysis(ctx, soundtracks)
+	}
 
-			// fire the request
-			resp, err = client.Do(req)
-			if resp.StatusCode != http.StatusTooManyRequests {
-				proceed = true
-				break
+	batch := rowBatch{
+		source:     artistID,
+		rows:       make([]interface{}, len(soundtracks)),
+		done:       trackIds,
+		checkpoint: p.checkpoint,
+	}
+	for i, soundtrack := range soundtracks {
+		if p.credited != nil {
+			for _, artist := range soundtrack.Artists {
+				p.credited.add(artist.Id)
 			}
 		}
-	} else if resp.StatusCode != http.StatusOK {
-		body, _ := ioutil.ReadAll(resp.Body)
-		fmt.Println("Error ", resp.StatusCode, string(body))
+
+		stats.add(soundtrack)
+
+		row := utils.CatalogRow{ArtistId: artistID, FullSoundtrack: soundtrack, Market: p.playMarket}
+		row.Album.AlbumGroup = p.groupOf(soundtrack.Album.Id)
+		if p.details {
+			row.AlbumDetails = p.detailsOf(soundtrack.Album.Id)
+		}
+		if p.features {
+			row.AudioFeatures = features[soundtrack.Id]
+		}
+		batch.rows[i] = row
 	}
-	defer resp.Body.Close()
 
-	if proceed {
-		err = json.NewDecoder(resp.Body).Decode(&soundtrack)
-		if err != nil {
-			log.Println("Could not parse JSON response. ", err.Error())
+	p.writer.Send(batch)
+}
+
+// getAudioFeatures looks up the audio features of a batch of tracks through
+// /audio-features?ids= and returns them by track id. Tracks keep their rows
+// when the lookup fails, just without features.
+func (p *pipeline) getAudioFeatures(ctx context.Context, soundtracks []utils.FullSoundtrack) map[string]*utils.AudioFeatures {
+	features := make(map[string]*utils.AudioFeatures, len(soundtracks))
 
+	ids := make([]string, 0, len(soundtracks))
+	for _, soundtrack := range soundtracks {
+		if soundtrack.Id != "" {
+			ids = append(ids, soundtrack.Id)
 		}
-		mu.Lock()
-		*songlist = append(*songlist, soundtrack)
-		mu.Unlock()
 	}
+	if len(ids) == 0 {
+		return features
+	}
+
+	// Fire it away
+	color.Cyan("[getAudioFeatures] Getting audio features of %d tracks", len(ids))
+	found, err := p.client.AudioFeatures(ctx, ids)
+	if err != nil {
+		log.Println("[getAudioFeatures] Error in request", err.Error())
+		return features
+	}
+	for i := range found {
+		features[found[i].Id] = &found[i]
+	}
+	if len(found) < len(ids) {
+		color.Red("[getAudioFeatures] %d of %d tracks have no audio features", len(ids)-len(found), len(ids))
+	}
+	return features
 }
 
-// Writes a song to CSV
-func WritetoCSV(songlist []utils.FullSoundtrack) {
+// saveAudioAnalysis saves the audio analysis of every track of a batch to
+// <analysisDir>/<trackID>.json, skipping tracks saved before
+func (p *pipeline) saveAudioAnalysis(ctx context.Context, soundtracks []utils.FullSoundtrack) {
+	for _, soundtrack := range soundtracks {
+		if soundtrack.Id == "" || stopped(p.stop) {
+			continue
+		}
+		path := filepath.Join(p.analysisDir, soundtrack.Id+".json")
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+
+		// Fire it away
+		color.Cyan("[saveAudioAnalysis] Getting audio analysis of %s", soundtrack.Id)
+		analysis, err := p.client.AudioAnalysis(ctx, soundtrack.Id)
+		if err != nil {
+			log.Println("[saveAudioAnalysis] Error in request", err.Error())
+			continue
+		}
 
-	log.Println("[WRITER] Writing to file")
+		// Write to a temporary file first so an interrupted run never
+		// leaves half an analysis behind
+		tmp := path + ".tmp"
+		if err := ioutil.WriteFile(tmp, analysis, 0644); err != nil {
+			log.Println("[saveAudioAnalysis] Cannot write file", err.Error())
+			continue
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			log.Println("[saveAudioAnalysis] Cannot write file", err.Error())
+		}
+	}
+}
 
-	file, err := os.OpenFile(os.Getenv("OUTPUT_FILE"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+// outputFileFor returns the file output is written to: the --output flag,
+// OUTPUT_FILE or output.<format> in the current directory
+func outputFileFor(path, format string) string {
+	if path == "" {
+		path = os.Getenv("OUTPUT_FILE")
+	}
+	if path == "" {
+		path = "output" + output.Extension(format)
+	}
+	return path
+}
 
+// userMarket returns the country of the current user, or from_token when
+// the token isn't allowed to tell
+func userMarket(ctx context.Context, client *spotify.Client) string {
+	user, err := client.Me(ctx)
 	if err != nil {
-		log.Fatal("[WRITER] Cannot create file", err)
+		log.Println("[fetch] Could not look up your country", err.Error())
+		return "from_token"
+	}
+	if user.Country == "" {
+		return "from_token"
+	}
+	return user.Country
+}
+
+// playabilityMarket returns the market tracks are to be looked up in, if
+// any. Spotify leaves available_markets out of whatever is looked up in a
+// market, so one is only sent when --market is given or when columns tell
+// about playability, and then defaults to the country of the current user.
+func playabilityMarket(ctx context.Context, client *spotify.Client, market string, columns []output.Column) string {
+	if market == "" {
+		wanted := false
+		for _, column := range columns {
+			name := column.Name()
+			wanted = wanted || name == "is_playable" || strings.HasPrefix(name, "restrictions") || strings.HasPrefix(name, "linked_from")
+		}
+		if !wanted {
+			return ""
+		}
+	}
+	if market == "" || market == "from_token" {
+		return userMarket(ctx, client)
+	}
+	return market
+}
+
+// checkDedup makes sure strategy is one of utils.DedupStrategies, if set
+func checkDedup(strategy string) error {
+	if strategy == "" {
+		return nil
+	}
+	for _, s := range utils.DedupStrategies {
+		if s == strategy {
+			return nil
+		}
 	}
-	defer file.Close()
+	return fmt.Errorf("unknown strategy %q, use one of %s", strategy, strings.Join(utils.DedupStrategies, ", "))
+}
 
-	w := struct2csv.NewWriter(file)
-	w.SetComma('\t')
-	w.SetSeparators("|", "|")
+// checkAlbumFilters makes sure the --groups and --market flags hold values
+// Spotify understands and returns the market in the form it expects
+func checkAlbumFilters(groups []string, market string) (string, error) {
+	for i, group := range groups {
+		group = strings.ToLower(strings.TrimSpace(group))
+		known := false
+		for _, g := range spotify.AlbumGroups {
+			known = known || g == group
+		}
+		if !known {
+			return "", fmt.Errorf("unknown album group %q, use any of %s", group, strings.Join(spotify.AlbumGroups, ", "))
+		}
+		groups[i] = group
+	}
 
-	err = w.WriteStructs(songlist)
-	if err != nil {
-		// handle error
-		log.Println("[WRITER] Error", err.Error())
+	if market == "" || strings.EqualFold(market, "from_token") {
+		return strings.ToLower(market), nil
+	}
+	market = strings.ToUpper(market)
+	if !isCountryCode(market) {
+		return "", fmt.Errorf("%q is not a market, use a two letter country code or from_token", market)
+	}
+	return market, nil
+}
+
+// isCountryCode reports whether s looks like an ISO 3166-1 alpha-2 code
+func isCountryCode(s string) bool {
+	if len(s) != 2 {
+		return false
+	}
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// pickColumns returns the columns of the preset saved in the config file
+// followed by the ones given by path, as found in rows like row, for output
+// in format. Without either it returns nil and every column is written.
+func pickColumns(format, preset string, paths []string, row interface{}) ([]output.Column, error) {
+	var specs []string
+	if preset != "" {
+		key := "columns." + preset
+		if !viper.IsSet(key) {
+			var names []string
+			for name := range viper.GetStringMap("columns") {
+				names = append(names, name)
+			}
+			if len(names) < 1 {
+				return nil, fmt.Errorf("no column presets are saved in the config file")
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("no column preset named %q, saved presets are %s", preset, strings.Join(names, ", "))
+		}
+		specs = append(specs, viper.GetStringSlice(key)...)
+	}
+	specs = append(specs, paths...)
+
+	if len(specs) < 1 {
+		return nil, nil
 	}
+	if !output.Tabular(format) {
+		return nil, fmt.Errorf("columns can only be picked for csv and tsv output, not %s", format)
+	}
+	return output.ParseColumns(specs, row)
+}
 
+// catalogColumns returns every column of a catalog row, apart from the
+// extras that were not asked for
+func (o fetchOptions) catalogColumns() []output.Column {
+	var columns []output.Column
+	for _, column := range output.ColumnsOf(utils.CatalogRow{}) {
+		name := column.Name()
+		if (!o.albumDetails && strings.HasPrefix(name, "album_details.")) ||
+			(!o.audioFeatures && strings.HasPrefix(name, "audio_features.")) ||
+			(o.dedup == "" && name == "alternate_ids") {
+			continue
+		}
+		columns = append(columns, column)
+	}
+	return columns
 }
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/fatih/color"
+)
+
+// watchInterrupts handles SIGINT and SIGTERM for long running commands. The
+// returned stop channel is closed on the first signal, after which no new
+// requests should be started while in-flight ones are allowed to finish. A
+// second signal cancels ctx to drop the in-flight requests as well, and a
+// third one falls back to the default behaviour of killing the process.
+//
+// release must be called once the command is done.
+func watchInterrupts() (ctx context.Context, stop <-chan struct{}, release func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-sigCh:
+			color.Red("\nInterrupted, finishing requests in flight. Interrupt again to stop right away.")
+			close(stopCh)
+		case <-done:
+			return
+		}
+
+		select {
+		case <-sigCh:
+			color.Red("\nStopping now, saving what has been fetched so far.")
+			signal.Stop(sigCh)
+			cancel()
+		case <-done:
+		}
+	}()
+
+	release = func() {
+		signal.Stop(sigCh)
+		close(done)
+		cancel()
+	}
+	return ctx, stopCh, release
+}
+
+// stopped reports whether stop has been closed
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
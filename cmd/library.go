@@ -0,0 +1,265 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/shashankgroovy/morag/output"
+	"github.com/shashankgroovy/morag/spotify"
+	"github.com/shashankgroovy/morag/utils"
+	"github.com/spf13/cobra"
+)
+
+// libraryCmd represents the library command
+var libraryCmd = &cobra.Command{
+	Use:   "library",
+	Short: "Fetches your saved tracks, saved albums or followed artists.",
+	Long: `Library downloads what you keep in your own Spotify library: the tracks
+and albums you saved and the artists you follow. Pick one of them with a
+subcommand.
+
+Tracks are written just like fetch writes them, along with when you saved
+them (added_at). Albums are written one row each, with their label,
+genres and popularity, and artists with their profile. The --output,
+--format, --columns, --preset and --rate flags work as they do for fetch.
+When writing to SQLite what's in your library is kept in the library table.
+
+Reading your library needs permissions older logins did not ask for. If
+Spotify refuses, log out and log in again.
+
+USAGE:
+$ morag library tracks|albums|artists
+
+EXAMPLE:
+$ morag library tracks
+$ morag library albums --format json -o albums.json
+$ morag library artists --format sqlite -o catalog.db
+`,
+}
+
+// libraryKind is one of the parts of a library, fetched by a subcommand of
+// library
+type libraryKind struct {
+	name  string
+	short string
+	scope string
+
+	// row is a sample of the rows written, to pick columns from
+	row interface{}
+
+	// pager returns a function fetching the next page of rows
+	pager func(client *spotify.Client, market string) libraryPager
+}
+
+// libraryPager fetches the next page of a library, returning its rows, the
+// total number of items and whether there are more pages after it
+type libraryPager func(ctx context.Context) (rows []interface{}, total int, more bool, err error)
+
+var libraryKinds = []libraryKind{
+	{
+		name:  "tracks",
+		short: "Fetches the tracks saved in your library.",
+		scope: "user-library-read",
+		row:   utils.SavedTrackRow{},
+		pager: savedTracks,
+	},
+	{
+		name:  "albums",
+		short: "Fetches the albums saved in your library.",
+		scope: "user-library-read",
+		row:   utils.SavedAlbumRow{},
+		pager: savedAlbums,
+	},
+	{
+		name:  "artists",
+		short: "Fetches the artists you follow.",
+		scope: "user-follow-read",
+		row:   utils.FollowedArtistRow{},
+		pager: followedArtists,
+	},
+}
+
+var libraryOpts outputOptions
+
+func init() {
+	rootCmd.AddCommand(libraryCmd)
+
+	addOutputFlags(libraryCmd, &libraryOpts, "output", output.Formats, "added_at,name,artists.name")
+	libraryCmd.PersistentFlags().StringVar(&libraryOpts.market, "market", "", "Look tracks and albums up in this market, a country code such as US or from_token for your own")
+
+	for _, kind := range libraryKinds {
+		kind := kind
+		libraryCmd.AddCommand(&cobra.Command{
+			Use:   kind.name,
+			Short: kind.short,
+			Args:  cobra.NoArgs,
+			Run: func(cmd *cobra.Command, args []string) {
+				library(kind)
+			},
+		})
+	}
+}
+
+func library(kind libraryKind) {
+	libraryMarket, err := checkAlbumFilters(nil, libraryOpts.market)
+	if err != nil {
+		log.Println("Error in market", err.Error())
+		return
+	}
+
+	columns, err := pickColumns(libraryOpts.format, libraryOpts.preset, libraryOpts.columns, kind.row)
+	if err != nil {
+		log.Println("Error while picking columns", err.Error())
+		return
+	}
+
+	// check if a user is already authenticated
+	authToken, err := utils.TestAndSetToken()
+	if err != nil {
+		log.Println("Error while setting the auth token", err.Error())
+		return
+	}
+	if missing := authToken.MissingScopes(kind.scope); len(missing) > 0 {
+		color.Red("Your login doesn't allow morag to read your %s (%s is missing)", kind.name, strings.Join(missing, ", "))
+		fmt.Println("Use `morag logout` and `morag login` to log in again")
+		return
+	}
+
+	ctx, stop, release := watchInterrupts()
+	defer release()
+
+	client := spotify.NewClient(authToken.AccessToken)
+	client.Limiter = spotify.NewLimiter(libraryOpts.rate, 1)
+	client.OnRateLimit = func(cooldown time.Duration) {
+		color.Red("[library] Rate limited, pausing for %s", cooldown)
+	}
+
+	libraryMarket = playabilityMarket(ctx, client, libraryMarket, columns)
+
+	path := outputFileFor(libraryOpts.file, libraryOpts.format)
+	w, err := output.Create(libraryOpts.format, path, output.Options{Columns: columns})
+	if err != nil {
+		log.Println("[WRITER] Cannot create file", err)
+		return
+	}
+	writer := startWriter(w, "")
+
+	// Rows are sent to the writer a page at a time, as they come in
+	next := kind.pager(client, libraryMarket)
+	items, total := 0, 0
+	status := "ok"
+	for {
+		if stopped(stop) {
+			status = "interrupted"
+			break
+		}
+
+		color.Cyan("[library] Getting %s %d to %d", kind.name, items, items+spotify.MaxLimit)
+		rows, n, more, err := next(ctx)
+		if err != nil {
+			log.Println("[library] Error while fetching", kind.name, err.Error())
+			if e, ok := err.(*spotify.Error); ok && e.Status == 403 {
+				fmt.Println("Spotify refused, use `morag logout` and `morag login` to log in again")
+			}
+			status = "incomplete"
+			break
+		}
+		items += len(rows)
+		total = n
+		writer.Send(rowBatch{source: kind.name, rows: rows})
+
+		if !more || len(rows) == 0 {
+			break
+		}
+	}
+
+	writer.Sync()
+	if err := writer.Err(); err != nil {
+		status = "failed"
+	}
+	rows := writer.Rows(kind.name)
+	writer.Close()
+
+	line := fmt.Sprintf("%s %s: %d of %d, %d rows written to %s", kind.name, status, items, total, rows, path)
+	switch status {
+	case "ok":
+		color.Green(line)
+	case "failed":
+		color.Red(line)
+	default:
+		color.Yellow(line)
+	}
+
+	if status == "interrupted" {
+		release()
+		os.Exit(exitPartial)
+	}
+}
+
+// savedTracks pages through the saved tracks of the current user
+func savedTracks(client *spotify.Client, market string) libraryPager {
+	opt := &spotify.Options{Limit: spotify.MaxLimit, Market: market}
+	return func(ctx context.Context) ([]interface{}, int, bool, error) {
+		page, err := client.SavedTracks(ctx, opt)
+		if err != nil {
+			return nil, 0, false, err
+		}
+
+		var rows []interface{}
+		for _, item := range page.Items {
+			rows = append(rows, utils.SavedTrackRow{
+				AddedAt:        item.AddedAt,
+				FullSoundtrack: item.Track,
+				Market:         market,
+			})
+		}
+		opt.Offset = page.Offset + len(page.Items)
+		return rows, page.Total, page.Next != "", nil
+	}
+}
+
+// savedAlbums pages through the saved albums of the current user
+func savedAlbums(client *spotify.Client, market string) libraryPager {
+	opt := &spotify.Options{Limit: spotify.MaxLimit, Market: market}
+	return func(ctx context.Context) ([]interface{}, int, bool, error) {
+		page, err := client.SavedAlbums(ctx, opt)
+		if err != nil {
+			return nil, 0, false, err
+		}
+
+		var rows []interface{}
+		for _, item := range page.Items {
+			rows = append(rows, utils.SavedAlbumRow{
+				AddedAt:         item.AddedAt,
+				SimplifiedAlbum: item.Album.SimplifiedAlbum,
+				AlbumDetails:    item.Album.AlbumDetails,
+			})
+		}
+		opt.Offset = page.Offset + len(page.Items)
+		return rows, page.Total, page.Next != "", nil
+	}
+}
+
+// followedArtists pages through the artists followed by the current user.
+// They are paged by cursor, the id of the last artist seen.
+func followedArtists(client *spotify.Client, market string) libraryPager {
+	after := ""
+	return func(ctx context.Context) ([]interface{}, int, bool, error) {
+		page, err := client.FollowedArtists(ctx, after, spotify.MaxLimit)
+		if err != nil {
+			return nil, 0, false, err
+		}
+
+		var rows []interface{}
+		for _, artist := range page.Items {
+			rows = append(rows, utils.FollowedArtistRow{ArtistRow: artist.Row()})
+		}
+		after = page.Cursors.After
+		return rows, page.Total, page.Next != "" && after != "", nil
+	}
+}
@@ -20,15 +20,22 @@ var loginCmd = &cobra.Command{
 It opens up a login page in the default browser to connect your Spotify account and
 obtain an access token.
 
-Simply issue: "morag login" to initiate the authentication process.`,
+Simply issue: "morag login" to initiate the authentication process.
+
+Morag asks for the permissions it needs to read your country, library,
+followed artists and private playlists. Pick others with --scopes, after
+a logout if you are logged in already.`,
 	Run: loginFunc,
 }
 
 var baseURI string = os.Getenv("BASE_URI")
 var serverPort string = os.Getenv("PORT")
+var loginScopes []string
 
 func init() {
 	rootCmd.AddCommand(loginCmd)
+
+	loginCmd.Flags().StringSliceVar(&loginScopes, "scopes", server.DefaultScopes, "OAuth scopes to ask Spotify for")
 }
 
 // loginFunc helps authenticate a user by spawning a small server and
@@ -45,6 +52,7 @@ func loginFunc(cmd *cobra.Command, args []string) {
 		srvChan := make(chan bool, 1)
 
 		// Initialize a simple server
+		server.Scopes = loginScopes
 		srv := server.App{}
 		srv.Initialize(srvChan)
 
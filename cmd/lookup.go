@@ -0,0 +1,399 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/fatih/color"
+	"github.com/shashankgroovy/morag/output"
+	"github.com/shashankgroovy/morag/spotify"
+	"github.com/shashankgroovy/morag/utils"
+	"github.com/spf13/cobra"
+)
+
+// lookupCmd represents the lookup command
+var lookupCmd = &cobra.Command{
+	Use:   "lookup",
+	Short: "Finds the tracks and albums carrying ISRCs and UPCs.",
+	Long: `Lookup finds the Spotify tracks carrying the ISRCs listed in --isrc-file
+and the albums carrying the UPCs listed in --upc-file, to reconcile
+distributor spreadsheets with the catalog on Spotify.
+
+Both files hold a code per line, or rows of a CSV or TSV file with the
+code in the first column. A first line naming the column, with letters
+but no digits such as isrc or upc, is taken to be a header, as is the
+first line whatever it holds with --header. Codes may be written with
+spaces, dashes or dots, and UPCs match regardless of leading zeros or
+whether Spotify lists them as EAN. Use - to read the codes from stdin.
+
+A row is written for every code, telling whether it was found on a single
+track or album, on multiple of them, or is missing. Codes that aren't well
+formed are marked invalid and those that could not be looked up failed. A
+summary of the unmatched codes is printed at the end.
+
+USAGE:
+$ morag lookup --isrc-file <file> --upc-file <file>
+
+EXAMPLE:
+$ morag lookup --isrc-file isrcs.txt
+$ morag lookup --isrc-file distributor.csv --upc-file distributor_upcs.csv -o mapping.csv
+$ morag lookup --upc-file upcs.txt --format json -o mapping.json
+$ cut -d, -f3 report.csv | morag lookup --isrc-file -
+`,
+	Run: lookup,
+}
+
+// Statuses of a looked up code
+const (
+	lookupFound    = "found"
+	lookupMultiple = "multiple"
+	lookupMissing  = "missing"
+	lookupInvalid  = "invalid"
+	lookupFailed   = "failed"
+)
+
+var isrcFile string
+var upcFile string
+var codesHeader bool
+var lookupOpts outputOptions
+
+func init() {
+	rootCmd.AddCommand(lookupCmd)
+
+	lookupCmd.Flags().StringVar(&isrcFile, "isrc-file", "", "File listing the ISRCs to find tracks for")
+	lookupCmd.Flags().StringVar(&upcFile, "upc-file", "", "File listing the UPCs to find albums for")
+	lookupCmd.Flags().BoolVar(&codesHeader, "header", false, "Skip the first line of the files, naming their columns")
+	addOutputFlags(lookupCmd, &lookupOpts, "mapping", []string{"csv", "tsv", "json", "ndjson"}, "code,status,id,name")
+	lookupCmd.Flags().StringVar(&lookupOpts.market, "market", "", "Only find what's available in this market, a country code such as US or from_token for your own")
+}
+
+func lookup(cmd *cobra.Command, args []string) {
+	if isrcFile == "" && upcFile == "" {
+		// Print error, help text and exit
+		fmt.Printf("\nERROR: Please provide an --isrc-file or --upc-file.\n\n")
+		cmd.Help()
+		return
+	}
+	if isrcFile == "-" && upcFile == "-" {
+		log.Println("Error while reading codes", "only one of the files can be read from stdin")
+		return
+	}
+	if strings.ToLower(lookupOpts.format) == "sqlite" {
+		log.Println("Error in output format", "lookup writes csv, tsv, json or ndjson")
+		return
+	}
+
+	lookupMarket, err := checkAlbumFilters(nil, lookupOpts.market)
+	if err != nil {
+		log.Println("Error in market", err.Error())
+		return
+	}
+
+	columns, err := pickColumns(lookupOpts.format, lookupOpts.preset, lookupOpts.columns, utils.LookupRow{})
+	if err != nil {
+		log.Println("Error while picking columns", err.Error())
+		return
+	}
+
+	// Read every code up front so that a bad file is caught before any
+	// request is sent
+	var jobs []codeList
+	for _, list := range []struct{ kind, path string }{{utils.CodeISRC, isrcFile}, {utils.CodeUPC, upcFile}} {
+		if list.path == "" {
+			continue
+		}
+		codes, err := readCodes(list.kind, list.path, codesHeader)
+		if err != nil {
+			log.Println("Error while reading codes", err.Error())
+			return
+		}
+		jobs = append(jobs, codeList{kind: list.kind, codes: codes})
+	}
+
+	// check if a user is already authenticated
+	authToken, err := utils.TestAndSetToken()
+	if err != nil {
+		log.Println("Error while setting the auth token", err.Error())
+		return
+	}
+
+	ctx, stop, release := watchInterrupts()
+	defer release()
+
+	client := spotify.NewClient(authToken.AccessToken)
+	client.Limiter = spotify.NewLimiter(lookupOpts.rate, 1)
+	client.OnRateLimit = func(cooldown time.Duration) {
+		color.Red("[lookup] Rate limited, pausing for %s", cooldown)
+	}
+
+	path := lookupOpts.file
+	if path == "" {
+		path = os.Getenv("OUTPUT_FILE")
+	}
+	if path == "" {
+		path = "mapping" + output.Extension(lookupOpts.format)
+	}
+	w, err := output.Create(lookupOpts.format, path, output.Options{Columns: columns})
+	if err != nil {
+		log.Println("[WRITER] Cannot create file", err)
+		return
+	}
+	writer := startWriter(w, "")
+
+	interrupted := false
+	var summaries []lookupSummary
+	for _, job := range jobs {
+		summary := lookupSummary{kind: job.kind, statuses: make(map[string]int)}
+		for i, code := range job.codes {
+			if stopped(stop) {
+				interrupted = true
+				break
+			}
+
+			color.Cyan("[lookup] Looking up %s %s (%d of %d)", strings.ToUpper(job.kind), code, i+1, len(job.codes))
+			row := lookupCode(ctx, client, job.kind, code, lookupMarket)
+			summary.add(row)
+			writer.Send(rowBatch{source: job.kind, rows: []interface{}{row}})
+		}
+		summaries = append(summaries, summary)
+	}
+
+	writer.Sync()
+	writeErr := writer.Err()
+	writer.Close()
+
+	if interrupted {
+		color.Red("\nInterrupted, saved the codes looked up so far")
+	} else {
+		fmt.Println("\nFinished")
+	}
+	printLookupSummary(summaries, path, writeErr)
+
+	if interrupted {
+		release()
+		os.Exit(exitPartial)
+	}
+}
+
+// codeList is a list of codes of a single kind to look up
+type codeList struct {
+	kind  string
+	codes []string
+}
+
+// readCodes reads the codes of a kind listed in the file at path, or on
+// stdin for "-", in the first column of every line. The first line is
+// skipped if header is set or if it names the column. Codes are normalized
+// and listed once, in the order they first appear.
+func readCodes(kind, path string, header bool) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var codes []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for first := true; scanner.Scan(); first = false {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexAny(line, ",;\t"); i >= 0 {
+			line = line[:i]
+		}
+		code := utils.NormalizeCode(strings.Trim(line, `"' `))
+		if first && (header || isColumnName(code)) {
+			continue
+		}
+		if code == "" || seen[code] {
+			continue
+		}
+		seen[code] = true
+		codes = append(codes, code)
+	}
+	return codes, scanner.Err()
+}
+
+// isColumnName reports whether the first cell of a line names a column
+// rather than holding a code, which always has digits
+func isColumnName(cell string) bool {
+	return strings.IndexFunc(cell, unicode.IsLetter) >= 0 && strings.IndexFunc(cell, unicode.IsDigit) < 0
+}
+
+// lookupCode searches Spotify for the tracks carrying an ISRC or the albums
+// carrying a UPC. Only results whose external ids hold the code count, as
+// the search also lists near matches.
+func lookupCode(ctx context.Context, client *spotify.Client, kind, code, market string) utils.LookupRow {
+	row := utils.LookupRow{CodeType: kind, Code: code}
+	if !utils.ValidCode(kind, code) {
+		row.Status = lookupInvalid
+		return row
+	}
+
+	var err error
+	if kind == utils.CodeISRC {
+		err = lookupISRC(ctx, client, code, market, &row)
+	} else {
+		err = lookupUPC(ctx, client, code, market, &row)
+	}
+	if err != nil {
+		log.Println("[lookup] Error while looking up", code, err.Error())
+		row.Status = lookupFailed
+		return row
+	}
+
+	switch {
+	case row.Matches == 0:
+		row.Status = lookupMissing
+	case row.Matches == 1:
+		row.Status = lookupFound
+	default:
+		row.Status = lookupMultiple
+	}
+	return row
+}
+
+// lookupISRC fills in row with the tracks carrying an ISRC
+func lookupISRC(ctx context.Context, client *spotify.Client, isrc, market string, row *utils.LookupRow) error {
+	result, err := client.Search(ctx, utils.CodeISRC+":"+isrc, []string{"track"}, &spotify.Options{Limit: spotify.MaxLimit, Market: market})
+	if err != nil {
+		return err
+	}
+	if result.Tracks == nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	for _, track := range result.Tracks.Items {
+		if seen[track.Id] || !track.ExternalIds.Has(utils.CodeISRC, isrc) {
+			continue
+		}
+		seen[track.Id] = true
+		row.Matches++
+		if row.Matches > 1 {
+			row.OtherIds = append(row.OtherIds, track.Id)
+			continue
+		}
+		row.Id = track.Id
+		row.Name = track.Name
+		row.Artists = artistNameList(track.Artists)
+		row.Album = track.Album.Name
+		row.ReleaseDate = track.Album.ReleaseDate
+		row.ExternalIds = track.ExternalIds
+		row.Uri = track.Uri
+	}
+	return nil
+}
+
+// lookupUPC fills in row with the albums carrying a UPC. Albums found by the
+// search don't tell their UPC, so they are looked up in full to check it.
+func lookupUPC(ctx context.Context, client *spotify.Client, upc, market string, row *utils.LookupRow) error {
+	result, err := client.Search(ctx, utils.CodeUPC+":"+upc, []string{"album"}, &spotify.Options{Limit: spotify.MaxAlbumIDs, Market: market})
+	if err != nil {
+		return err
+	}
+	if result.Albums == nil || len(result.Albums.Items) == 0 {
+		return nil
+	}
+
+	var albumIDs []string
+	for _, album := range result.Albums.Items {
+		albumIDs = append(albumIDs, album.Id)
+	}
+	albums, err := client.Albums(ctx, albumIDs, market)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for _, album := range albums {
+		if seen[album.Id] || !album.ExternalIds.Has(utils.CodeUPC, upc) {
+			continue
+		}
+		seen[album.Id] = true
+		row.Matches++
+		if row.Matches > 1 {
+			row.OtherIds = append(row.OtherIds, album.Id)
+			continue
+		}
+		row.Id = album.Id
+		row.Name = album.Name
+		row.Artists = artistNameList(album.Artists)
+		row.Album = album.Name
+		row.ReleaseDate = album.ReleaseDate
+		row.ExternalIds = album.ExternalIds
+		row.Uri = album.Uri
+	}
+	return nil
+}
+
+// artistNameList returns the names of artists
+func artistNameList(artists []utils.SimplifiedArtist) []string {
+	var names []string
+	for _, artist := range artists {
+		names = append(names, artist.Name)
+	}
+	return names
+}
+
+// lookupSummary counts the codes of a kind by status and keeps the ones
+// left unmatched
+type lookupSummary struct {
+	kind      string
+	statuses  map[string]int
+	unmatched []string
+}
+
+func (s *lookupSummary) add(row utils.LookupRow) {
+	s.statuses[row.Status]++
+	if row.Status != lookupFound && row.Status != lookupMultiple {
+		s.unmatched = append(s.unmatched, row.Code+" ("+row.Status+")")
+	}
+}
+
+// maxUnmatched is the number of unmatched codes listed by the summary, the
+// rest are only found in the output
+const maxUnmatched = 20
+
+// printLookupSummary prints the number of codes of every kind by status and
+// lists those that weren't matched
+func printLookupSummary(summaries []lookupSummary, path string, writeErr error) {
+	fmt.Println("\nSummary")
+	for _, s := range summaries {
+		var counts []string
+		for _, status := range []string{lookupFound, lookupMultiple, lookupMissing, lookupInvalid, lookupFailed} {
+			counts = append(counts, fmt.Sprintf("%s %d", status, s.statuses[status]))
+		}
+		line := fmt.Sprintf("%-5s %s", strings.ToUpper(s.kind), strings.Join(counts, ", "))
+		if len(s.unmatched) == 0 {
+			color.Green(line)
+			continue
+		}
+		color.Yellow(line)
+
+		shown := s.unmatched
+		if len(shown) > maxUnmatched {
+			shown = shown[:maxUnmatched]
+		}
+		color.Yellow("    unmatched: %s", strings.Join(shown, ", "))
+		if len(s.unmatched) > len(shown) {
+			color.Yellow("    and %d more", len(s.unmatched)-len(shown))
+		}
+	}
+
+	if writeErr != nil {
+		color.Red("Could not write the mapping to %s (%s)", path, writeErr.Error())
+		return
+	}
+	color.Green("Wrote the mapping to %s", path)
+}
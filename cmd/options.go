@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// outputOptions holds the flags of a command writing rows: where and how to
+// write them, the columns to pick, the market to look things up in and how
+// fast to send requests. Every command keeps its own.
+type outputOptions struct {
+	file    string
+	format  string
+	columns []string
+	preset  string
+	market  string
+	rate    float64
+}
+
+// addOutputFlags adds --output, --format, --columns, --preset and --rate to
+// cmd and its subcommands, bound to opts. The output is named name.<format>
+// by default, formats lists the formats cmd can write and example a few of
+// its columns.
+func addOutputFlags(cmd *cobra.Command, opts *outputOptions, name string, formats []string, example string) {
+	flags := cmd.PersistentFlags()
+	flags.StringVarP(&opts.file, "output", "o", "", "Output file (default is $OUTPUT_FILE or "+name+".<format>)")
+	flags.StringVar(&opts.format, "format", "csv", "Output format: "+strings.Join(formats, ", "))
+	flags.StringSliceVar(&opts.columns, "columns", nil, "Columns to write to CSV and TSV files, e.g. "+example)
+	flags.StringVar(&opts.preset, "preset", "", "Write the columns saved under this name in the config file")
+	flags.Float64Var(&opts.rate, "rate", 10, "Maximum number of requests per second")
+}
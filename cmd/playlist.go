@@ -0,0 +1,313 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/shashankgroovy/morag/output"
+	"github.com/shashankgroovy/morag/spotify"
+	"github.com/shashankgroovy/morag/utils"
+	"github.com/spf13/cobra"
+)
+
+// playlistCmd represents the fetch playlist command
+var playlistCmd = &cobra.Command{
+	Use:   "playlist",
+	Short: "Fetches the tracks of a playlist.",
+	Long: `Fetches every item of one or more playlists from Spotify and saves them
+just like fetch saves the catalog of an artist. Playlist ids, spotify:playlist
+URIs and open.spotify.com links are accepted, or read from stdin by passing
+"-".
+
+Every row holds the track along with the playlist_id, its position in the
+playlist (counting from 0), when it was added (added_at) and by whom
+(added_by). Local files are written with what Spotify knows of them, which
+is little more than a name, and podcast episodes with the fields they share
+with tracks. Items that are no longer available are skipped.
+
+The --output, --format, --columns, --preset, --market and --rate flags work
+as they do for fetch. When writing to SQLite the items are kept in the
+playlist_tracks table.
+
+USAGE:
+$ morag fetch playlist [playlistID...]
+
+EXAMPLE:
+$ morag fetch playlist 37i9dQZF1DXcBWIGoYBM5M
+$ morag fetch playlist "https://open.spotify.com/playlist/37i9dQZF1DXcBWIGoYBM5M" --format json
+$ morag fetch playlist 37i9dQZF1DXcBWIGoYBM5M --columns position,added_at,added_by,name,artists.name
+`,
+	Run: playlist,
+}
+
+func init() {
+	fetchCmd.AddCommand(playlistCmd)
+}
+
+func playlist(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		// Print error, help text and exit
+		fmt.Printf("\nERROR: Please provide a Spotify playlistID.\n\n")
+		cmd.Help()
+		return
+	}
+
+	// The flags of fetch are shared with playlist
+	opts := fetchOpts.outputOptions
+
+	playlistIDs, err := readPlaylistInputs(args)
+	if err != nil {
+		log.Println("Error while reading playlistIDs", err.Error())
+		return
+	}
+
+	playMarket, err := checkAlbumFilters(nil, opts.market)
+	if err != nil {
+		log.Println("Error in market", err.Error())
+		return
+	}
+
+	columns, err := pickColumns(opts.format, opts.preset, opts.columns, utils.PlaylistRow{})
+	if err != nil {
+		log.Println("Error while picking columns", err.Error())
+		return
+	}
+
+	// check if a user is already authenticated
+	authToken, err := utils.TestAndSetToken()
+	if err != nil {
+		log.Println("Error while setting the auth token", err.Error())
+		return
+	}
+
+	ctx, stop, release := watchInterrupts()
+	defer release()
+
+	client := spotify.NewClient(authToken.AccessToken)
+	client.Limiter = spotify.NewLimiter(opts.rate, 1)
+	client.OnRateLimit = func(cooldown time.Duration) {
+		color.Red("[fetch] Rate limited, pausing for %s", cooldown)
+	}
+
+	playMarket = playabilityMarket(ctx, client, playMarket, columns)
+	if playMarket != "" {
+		color.Green("[fetch] Checking playability in %s", playMarket)
+	}
+
+	path := outputFileFor(opts.file, opts.format)
+	w, err := output.Create(opts.format, path, output.Options{Columns: columns})
+	if err != nil {
+		log.Println("[WRITER] Cannot create file", err)
+		return
+	}
+	writer := startWriter(w, "")
+
+	var summaries []playlistSummary
+	interrupted := false
+	for i, playlistID := range playlistIDs {
+		if stopped(stop) {
+			summaries = append(summaries, playlistSummary{PlaylistID: playlistID, Status: "skipped"})
+			continue
+		}
+
+		color.Green("\n[fetch] Fetching playlist %s (%d of %d)", playlistID, i+1, len(playlistIDs))
+		summary := fetchPlaylist(ctx, client, playlistID, playMarket, writer, stop)
+		interrupted = interrupted || summary.Status == "interrupted"
+
+		writer.Sync()
+		if err := writer.Err(); err != nil {
+			summary.Status = "failed"
+			summary.Err = err
+		}
+		summary.Rows = writer.Rows(playlistID)
+		summary.OutputFile = path
+		summaries = append(summaries, summary)
+	}
+	writer.Close()
+
+	if interrupted {
+		color.Red("\nInterrupted, saved the tracks fetched so far")
+	} else {
+		fmt.Println("\nFinished")
+	}
+	printPlaylistSummary(summaries)
+
+	if interrupted {
+		release()
+		os.Exit(exitPartial)
+	}
+}
+
+// readPlaylistInputs turns the arguments into playlistIDs. A "-" reads
+// them from stdin instead, one per line.
+func readPlaylistInputs(args []string) ([]string, error) {
+	var inputs []string
+	for _, arg := range args {
+		if arg != "-" {
+			inputs = append(inputs, arg)
+			continue
+		}
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line != "" && !strings.HasPrefix(line, "#") {
+				inputs = append(inputs, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var playlistIDs []string
+	for _, input := range inputs {
+		id, err := spotify.ParseID("playlist", input)
+		if err != nil {
+			return nil, err
+		}
+		playlistIDs = append(playlistIDs, id)
+	}
+	return playlistIDs, nil
+}
+
+// playlistSummary is the outcome of fetching a single playlist
+type playlistSummary struct {
+	PlaylistID  string
+	Name        string
+	Status      string
+	Items       int
+	Expected    int
+	Rows        int
+	Episodes    int
+	Local       int
+	Unavailable int
+	OutputFile  string
+	Err         error
+
+	Market string
+	Play   *playStats
+}
+
+// fetchPlaylist pages through the items of a playlist and sends them to
+// writer as they come in
+func fetchPlaylist(ctx context.Context, client *spotify.Client, playlistID, market string, writer *rowWriter, stop <-chan struct{}) playlistSummary {
+	summary := playlistSummary{PlaylistID: playlistID, Status: "ok", Market: market, Play: &playStats{}}
+
+	info, err := client.Playlist(ctx, playlistID)
+	if err != nil {
+		log.Println("[fetchPlaylist] Error while fetching the playlist", err.Error())
+		summary.Status = "failed"
+		summary.Err = err
+		return summary
+	}
+	summary.Name = info.Name
+	summary.Expected = info.Tracks.Total
+
+	opt := &spotify.Options{Limit: spotify.MaxPlaylistLimit, Market: market}
+	for {
+		if stopped(stop) {
+			summary.Status = "interrupted"
+			return summary
+		}
+
+		color.Cyan("[fetchPlaylist] Getting items %d to %d of %s", opt.Offset, opt.Offset+opt.Limit, playlistID)
+		page, err := client.PlaylistItems(ctx, playlistID, opt)
+		if err != nil {
+			log.Println("[fetchPlaylist] Error while fetching items", err.Error())
+			summary.Status = "incomplete"
+			summary.Err = err
+			return summary
+		}
+
+		var rows []interface{}
+		for i, item := range page.Items {
+			summary.Items++
+			if item.Track == nil {
+				summary.Unavailable++
+				continue
+			}
+
+			switch {
+			case item.IsLocal:
+				summary.Local++
+			case item.Track.Type == "episode":
+				summary.Episodes++
+			default:
+				summary.Play.add(*item.Track)
+			}
+
+			track := *item.Track
+			track.IsLocal = track.IsLocal || item.IsLocal
+			rows = append(rows, utils.PlaylistRow{
+				PlaylistId:     playlistID,
+				Position:       page.Offset + i,
+				AddedAt:        item.AddedAt,
+				AddedBy:        item.AddedBy.Id,
+				FullSoundtrack: track,
+				Market:         market,
+			})
+		}
+		writer.Send(rowBatch{source: playlistID, rows: rows})
+
+		if page.Next == "" || len(page.Items) == 0 {
+			break
+		}
+		opt.Offset = page.Offset + len(page.Items)
+	}
+
+	if summary.Items < summary.Expected {
+		summary.Status = "incomplete"
+	}
+	return summary
+}
+
+// printPlaylistSummary prints a line per playlist telling how the fetch went
+func printPlaylistSummary(summaries []playlistSummary) {
+	fmt.Println("\nSummary")
+	for _, s := range summaries {
+		line := fmt.Sprintf("%-24s %-12s items %d/%d  rows %d  %s",
+			s.PlaylistID, s.Status, s.Items, s.Expected, s.Rows, s.OutputFile)
+		if s.Name != "" {
+			line = fmt.Sprintf("%s (%s)", line, s.Name)
+		}
+		if s.Err != nil {
+			line += "  (" + s.Err.Error() + ")"
+		}
+
+		switch s.Status {
+		case "ok":
+			color.Green(line)
+		case "failed":
+			color.Red(line)
+		default:
+			color.Yellow(line)
+		}
+		if s.Local > 0 || s.Episodes > 0 {
+			color.Yellow("    local files: %d, episodes: %d", s.Local, s.Episodes)
+		}
+		if s.Unavailable > 0 {
+			color.Yellow("    no longer available: %d", s.Unavailable)
+		}
+		if s.Play == nil {
+			continue
+		}
+		if s.Play.Relinked > 0 {
+			color.Yellow("    relinked to copies playable in %s: %d", s.Market, s.Play.Relinked)
+		}
+		if s.Play.Unplayable > 0 {
+			var reasons []string
+			for reason, n := range s.Play.Reasons {
+				reasons = append(reasons, fmt.Sprintf("%s %d", reason, n))
+			}
+			sort.Strings(reasons)
+			color.Yellow("    not playable in %s: %d (%s)", s.Market, s.Play.Unplayable, strings.Join(reasons, ", "))
+		}
+	}
+}
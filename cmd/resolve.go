@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/shashankgroovy/morag/spotify"
+	"github.com/shashankgroovy/morag/utils"
+)
+
+// maxCandidates is the number of search results offered when a name is
+// ambiguous
+const maxCandidates = 10
+
+// resolveArtists turns every input into an artistID. Ids, spotify:artist URIs
+// and open.spotify.com links are used as they are, anything else is taken to
+// be the name of an artist and looked up with a search. Inputs that can't be
+// resolved are reported and left out.
+func resolveArtists(ctx context.Context, client *spotify.Client, inputs []string) []string {
+	var ids []string
+	seen := make(map[string]bool)
+
+	for _, input := range inputs {
+		id, err := spotify.ParseID("artist", input)
+		if err != nil {
+			id, err = searchArtist(ctx, client, input)
+		}
+		if err != nil {
+			color.Red("[resolve] Skipping %q: %s", input, err.Error())
+			continue
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// searchArtist looks up an artist by name. A single artist carrying exactly
+// that name is picked right away, otherwise the user is asked to choose
+// between the candidates.
+func searchArtist(ctx context.Context, client *spotify.Client, name string) (string, error) {
+	color.Yellow("[resolve] Searching for artist %q", name)
+	result, err := client.Search(ctx, name, []string{"artist"}, &spotify.Options{Limit: maxCandidates})
+	if err != nil {
+		return "", err
+	}
+	if result.Artists == nil || len(result.Artists.Items) == 0 {
+		return "", fmt.Errorf("no artist found")
+	}
+	candidates := result.Artists.Items
+
+	var exact []utils.FullArtist
+	for _, artist := range candidates {
+		if normalizeName(artist.Name) == normalizeName(name) {
+			exact = append(exact, artist)
+		}
+	}
+
+	switch {
+	case len(exact) == 1:
+		return pickArtist(name, exact[0]), nil
+	case len(candidates) == 1:
+		return pickArtist(name, candidates[0]), nil
+	case len(exact) > 1:
+		// Several artists share the name, only offer those
+		candidates = exact
+	}
+
+	if !isTerminal(os.Stdin) {
+		// Nobody to ask, Spotify ranks the likeliest match first
+		color.Red("[resolve] %q is ambiguous, going with the top result", name)
+		return pickArtist(name, candidates[0]), nil
+	}
+	return chooseArtist(name, candidates)
+}
+
+// chooseArtist asks the user which of the candidates they meant
+func chooseArtist(name string, candidates []utils.FullArtist) (string, error) {
+	color.Yellow("\nSeveral artists match %q:", name)
+	for i, artist := range candidates {
+		fmt.Printf("  %2d) %s  (%d followers", i+1, artist.Name, artist.Followers.Total)
+		if len(artist.Genres) > 0 {
+			fmt.Printf(", %s", strings.Join(artist.Genres, ", "))
+		}
+		fmt.Printf(")  %s\n", artist.Id)
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Printf("Pick one [1-%d], or press enter to skip: ", len(candidates))
+		answer, err := reader.ReadString('\n')
+		answer = strings.TrimSpace(answer)
+		if answer == "" {
+			if err != nil {
+				return "", err
+			}
+			return "", fmt.Errorf("skipped")
+		}
+
+		choice, convErr := strconv.Atoi(answer)
+		if convErr == nil && choice >= 1 && choice <= len(candidates) {
+			return pickArtist(name, candidates[choice-1]), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		fmt.Println("Not a valid choice")
+	}
+}
+
+// pickArtist reports which artist a name was resolved to
+func pickArtist(name string, artist utils.FullArtist) string {
+	color.Green("[resolve] %q is %s (%s)", name, artist.Name, artist.Id)
+	return artist.Id
+}
+
+// normalizeName makes names comparable regardless of case and spacing
+func normalizeName(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -13,6 +13,10 @@ import (
 
 var cfgFile string
 
+// exitPartial is the exit status of a run that was interrupted, or lost
+// requests, and only saved part of what it set out to fetch
+const exitPartial = 3
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "morag",
@@ -21,7 +25,8 @@ var rootCmd = &cobra.Command{
 from Spotify and saves it to a csv file. It uses OAuth2 for authentication.
 
 Issue the login command to start fetching data from Spotify`,
-	Run: root,
+	PersistentPreRunE: checkRate,
+	Run:               root,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -69,8 +74,25 @@ func initConfig() {
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+	}
+}
+
+// checkRate rejects a --rate that would never let a request through, on
+// whichever command has one
+func checkRate(cmd *cobra.Command, args []string) error {
+	flag := cmd.Flags().Lookup("rate")
+	if flag == nil {
+		return nil
+	}
+	rate, err := cmd.Flags().GetFloat64("rate")
+	if err != nil {
+		return err
+	}
+	if rate <= 0 {
+		return fmt.Errorf("--rate must be above 0, got %s", flag.Value.String())
 	}
+	return nil
 }
 
 // Calls help if a user is not logged in else shows app banner and tries to
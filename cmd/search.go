@@ -0,0 +1,320 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/shashankgroovy/morag/spotify"
+	"github.com/shashankgroovy/morag/utils"
+	"github.com/spf13/cobra"
+)
+
+// searchCmd represents the search command
+var searchCmd = &cobra.Command{
+	Use:   "search",
+	Short: "Searches Spotify for tracks, albums, artists or playlists.",
+	Long: `Search looks up the Spotify catalog to find the ids of tracks, albums,
+artists or playlists. Pick what to look for with --type, artists unless
+told otherwise.
+
+The query can be narrowed down with Spotify's field filters, typed right
+into it or given as flags: --artist, --year (a year or a range such as
+1990-1999), --isrc and --upc. Up to --limit results of every type are
+listed, but Spotify won't page past its first thousand.
+
+Results are printed as a table, as JSON with --format json, or with
+--format ids as nothing but their ids, one per line, which fetch and
+fetch playlist read from stdin.
+
+USAGE:
+$ morag search [query]
+
+EXAMPLE:
+$ morag search "band of horses"
+$ morag search "the funeral" --type track --artist "band of horses"
+$ morag search --type album --upc 886443546264
+$ morag search --type track --isrc USSM11300080 --format json
+$ morag search "genre:shoegaze" --year 1990-1995 --limit 100 --format ids | morag fetch -
+$ morag search "indie folk" --type playlist --limit 5 --format ids | morag fetch playlist -
+`,
+	Run: search,
+}
+
+// searchFormats lists the formats search results can be printed in
+var searchFormats = []string{"table", "json", "ids"}
+
+var searchTypes []string
+var searchFormat string
+var searchLimit int
+var searchByArtist string
+var searchByYear string
+var searchByISRC string
+var searchByUPC string
+var searchMarket string
+
+func init() {
+	rootCmd.AddCommand(searchCmd)
+
+	searchCmd.Flags().StringSliceVar(&searchTypes, "type", []string{"artist"}, "Types to search for: "+strings.Join(spotify.SearchTypes, ", "))
+	searchCmd.Flags().StringVar(&searchFormat, "format", "table", "Output format: "+strings.Join(searchFormats, ", "))
+	searchCmd.Flags().IntVar(&searchLimit, "limit", 20, "Number of results to list of every type")
+	searchCmd.Flags().StringVar(&searchByArtist, "artist", "", "Only find what's by this artist")
+	searchCmd.Flags().StringVar(&searchByYear, "year", "", "Only find what was released in this year or range of years, e.g. 1994 or 1990-1999")
+	searchCmd.Flags().StringVar(&searchByISRC, "isrc", "", "Only find the tracks with this ISRC")
+	searchCmd.Flags().StringVar(&searchByUPC, "upc", "", "Only find the albums with this UPC")
+	searchCmd.Flags().StringVar(&searchMarket, "market", "", "Only find what's available in this market, a country code such as US or from_token for your own")
+}
+
+// searchResults holds what was found of every type searched for
+type searchResults struct {
+	Tracks    []utils.FullSoundtrack  `json:"tracks,omitempty"`
+	Albums    []utils.SimplifiedAlbum `json:"albums,omitempty"`
+	Artists   []utils.FullArtist      `json:"artists,omitempty"`
+	Playlists []utils.Playlist        `json:"playlists,omitempty"`
+
+	// Totals is the number of results Spotify knows of, by type
+	Totals map[string]int `json:"totals"`
+}
+
+func search(cmd *cobra.Command, args []string) {
+	query := searchQuery(strings.Join(args, " "), searchByArtist, searchByYear, searchByISRC, searchByUPC)
+	if query == "" {
+		// Print error, help text and exit
+		fmt.Printf("\nERROR: Please provide something to search for.\n\n")
+		cmd.Help()
+		return
+	}
+
+	err := checkSearch(searchTypes, searchFormat)
+	if err != nil {
+		log.Println("Error in search options", err.Error())
+		return
+	}
+	searchMarket, err = checkAlbumFilters(nil, searchMarket)
+	if err != nil {
+		log.Println("Error in market", err.Error())
+		return
+	}
+
+	// Results are printed to stdout, to be piped elsewhere, and everything
+	// else to stderr
+	out := os.Stdout
+	restore := stdoutToStderr()
+	defer restore()
+
+	// check if a user is already authenticated
+	authToken, err := utils.TestAndSetToken()
+	if err != nil {
+		log.Println("Error while setting the auth token", err.Error())
+		return
+	}
+
+	ctx := context.Background()
+	client := spotify.NewClient(authToken.AccessToken)
+	client.OnRateLimit = func(cooldown time.Duration) {
+		color.Red("[search] Rate limited, pausing for %s", cooldown)
+	}
+
+	results := &searchResults{Totals: make(map[string]int)}
+	for _, kind := range searchTypes {
+		if err := searchType(ctx, client, query, kind, searchLimit, searchMarket, results); err != nil {
+			log.Println("[search] Error while searching", err.Error())
+		}
+	}
+
+	switch searchFormat {
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(results)
+	case "ids":
+		err = printSearchIDs(out, results)
+	default:
+		err = printSearchTable(out, results)
+		for _, kind := range searchTypes {
+			color.Yellow("%d %ss found", results.Totals[kind], kind)
+		}
+	}
+	if err != nil {
+		log.Println("[search] Error", err.Error())
+	}
+}
+
+// searchQuery adds field filters for whichever of artist, year, isrc and
+// upc are set to query
+func searchQuery(query, artist, year, isrc, upc string) string {
+	filters := []string{strings.TrimSpace(query)}
+	add := func(field, value string) {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return
+		}
+		if strings.ContainsAny(value, " \t") {
+			value = strconv.Quote(value)
+		}
+		filters = append(filters, field+":"+value)
+	}
+	add("artist", artist)
+	add("year", year)
+	add("isrc", isrc)
+	add("upc", upc)
+	return strings.TrimSpace(strings.Join(filters, " "))
+}
+
+// checkSearch makes sure types are all spotify.SearchTypes and format is
+// one of searchFormats
+func checkSearch(types []string, format string) error {
+	if len(types) == 0 {
+		return fmt.Errorf("no type to search for, use any of %s", strings.Join(spotify.SearchTypes, ", "))
+	}
+	for i, kind := range types {
+		kind = strings.ToLower(strings.TrimSpace(kind))
+		known := false
+		for _, t := range spotify.SearchTypes {
+			known = known || t == kind
+		}
+		if !known {
+			return fmt.Errorf("unknown type %q, use any of %s", kind, strings.Join(spotify.SearchTypes, ", "))
+		}
+		types[i] = kind
+	}
+
+	for _, f := range searchFormats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown format %q, use one of %s", format, strings.Join(searchFormats, ", "))
+}
+
+// searchType pages through the results of a single type, up to limit of
+// them or as far as Spotify lets, and adds them to results
+func searchType(ctx context.Context, client *spotify.Client, query, kind string, limit int, market string, results *searchResults) error {
+	found := 0
+	for offset := 0; found < limit; {
+		n := limit - found
+		if n > spotify.MaxLimit {
+			n = spotify.MaxLimit
+		}
+		// Spotify refuses a page reaching past MaxSearchOffset
+		if offset+n > spotify.MaxSearchOffset {
+			n = spotify.MaxSearchOffset - offset
+		}
+		if n < 1 {
+			color.Yellow("[search] Spotify lists no more than %d %ss", spotify.MaxSearchOffset, kind)
+			break
+		}
+
+		color.Cyan("[search] Getting %ss %d to %d", kind, offset, offset+n)
+		result, err := client.Search(ctx, query, []string{kind}, &spotify.Options{Limit: n, Offset: offset, Market: market})
+		if err != nil {
+			return err
+		}
+
+		var paging utils.Paging
+		switch {
+		case kind == "track" && result.Tracks != nil:
+			results.Tracks = append(results.Tracks, result.Tracks.Items...)
+			paging, found = result.Tracks.Paging, found+len(result.Tracks.Items)
+		case kind == "album" && result.Albums != nil:
+			results.Albums = append(results.Albums, result.Albums.Items...)
+			paging, found = result.Albums.Paging, found+len(result.Albums.Items)
+		case kind == "artist" && result.Artists != nil:
+			results.Artists = append(results.Artists, result.Artists.Items...)
+			paging, found = result.Artists.Paging, found+len(result.Artists.Items)
+		case kind == "playlist" && result.Playlists != nil:
+			results.Playlists = append(results.Playlists, result.Playlists.Items...)
+			paging, found = result.Playlists.Paging, found+len(result.Playlists.Items)
+		}
+		results.Totals[kind] = paging.Total
+
+		if paging.Next == "" {
+			break
+		}
+		offset += n
+	}
+	return nil
+}
+
+// printSearchTable prints a row per result, telling what it is and enough
+// about it to pick the right one
+func printSearchTable(w io.Writer, results *searchResults) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tID\tNAME\tDETAILS")
+	for _, track := range results.Tracks {
+		details := fmt.Sprintf("%s, %s (%s)", artistNames(track.Artists), track.Album.Name, releaseYear(track.Album.ReleaseDate))
+		fmt.Fprintf(tw, "track\t%s\t%s\t%s\n", track.Id, track.Name, details)
+	}
+	for _, album := range results.Albums {
+		details := fmt.Sprintf("%s, %s (%s)", artistNames(album.Artists), album.AlbumType, releaseYear(album.ReleaseDate))
+		fmt.Fprintf(tw, "album\t%s\t%s\t%s\n", album.Id, album.Name, details)
+	}
+	for _, artist := range results.Artists {
+		details := fmt.Sprintf("%d followers", artist.Followers.Total)
+		if len(artist.Genres) > 0 {
+			details += ", " + strings.Join(artist.Genres, ", ")
+		}
+		fmt.Fprintf(tw, "artist\t%s\t%s\t%s\n", artist.Id, artist.Name, details)
+	}
+	for _, playlist := range results.Playlists {
+		details := fmt.Sprintf("by %s, %d tracks", playlist.Owner.DisplayName, playlist.Tracks.Total)
+		fmt.Fprintf(tw, "playlist\t%s\t%s\t%s\n", playlist.Id, playlist.Name, details)
+	}
+	return tw.Flush()
+}
+
+// printSearchIDs prints the id of every result, one per line
+func printSearchIDs(w io.Writer, results *searchResults) error {
+	var ids []string
+	for _, track := range results.Tracks {
+		ids = append(ids, track.Id)
+	}
+	for _, album := range results.Albums {
+		ids = append(ids, album.Id)
+	}
+	for _, artist := range results.Artists {
+		ids = append(ids, artist.Id)
+	}
+	for _, playlist := range results.Playlists {
+		ids = append(ids, playlist.Id)
+	}
+	for _, id := range ids {
+		if _, err := fmt.Fprintln(w, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// artistNames joins the names of artists
+func artistNames(artists []utils.SimplifiedArtist) string {
+	return strings.Join(artistNameList(artists), ", ")
+}
+
+// releaseYear returns the year of a release date, which Spotify gives as
+// precisely as it knows it
+func releaseYear(date string) string {
+	if len(date) < 4 {
+		return "unknown year"
+	}
+	return date[:4]
+}
+
+// stdoutToStderr sends whatever is printed to stdout to stderr instead,
+// until the returned function is called
+func stdoutToStderr() (restore func()) {
+	stdout, colorOutput := os.Stdout, color.Output
+	os.Stdout, color.Output = os.Stderr, color.Error
+	return func() {
+		os.Stdout, color.Output = stdout, colorOutput
+	}
+}
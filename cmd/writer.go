@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"log"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/shashankgroovy/morag/output"
+	"github.com/shashankgroovy/morag/utils"
+)
+
+// rowBatch is a batch of rows ready to be written
+type rowBatch struct {
+	// source is the artist or playlist the rows were fetched for
+	source string
+	rows   []interface{}
+
+	// done lists the requested track ids the batch covers, they are
+	// recorded in checkpoint once the rows are flushed
+	done       []string
+	checkpoint *utils.ArtistCheckpoint
+
+	// synced, if set, is closed once everything sent before it is written
+	synced chan struct{}
+}
+
+// rowWriter is the single goroutine writing rows to an output. Track workers
+// send it batches as soon as they come back, so rows never pile up in memory
+// and whatever was written is flushed should the run die.
+//
+// Deduplicating is the exception: duplicates can only be told apart once
+// all tracks of an artist are in, so batches are held back until the next
+// Sync or Close.
+type rowWriter struct {
+	w       output.Writer
+	batches chan rowBatch
+
+	// dedup is the utils.Dedup strategy applied to the rows, if any
+	dedup   string
+	pending []rowBatch
+
+	done chan struct{}
+
+	mu   sync.Mutex
+	rows map[string]int
+	err  error
+}
+
+// startWriter starts a rowWriter writing to w, deduplicating the rows of
+// every artist with the given strategy unless it is empty
+func startWriter(w output.Writer, dedup string) *rowWriter {
+	rw := &rowWriter{
+		w:       w,
+		dedup:   dedup,
+		batches: make(chan rowBatch),
+		done:    make(chan struct{}),
+		rows:    make(map[string]int),
+	}
+	go rw.run()
+	return rw
+}
+
+func (rw *rowWriter) run() {
+	defer close(rw.done)
+
+	for batch := range rw.batches {
+		if batch.synced != nil {
+			rw.commitPending()
+			close(batch.synced)
+			continue
+		}
+		if rw.dedup != "" {
+			rw.pending = append(rw.pending, batch)
+			continue
+		}
+		rw.commit(batch)
+	}
+	rw.commitPending()
+}
+
+// commit writes a batch and records its tracks in the checkpoint
+func (rw *rowWriter) commit(batch rowBatch) {
+	if rw.Err() != nil {
+		// The output is broken, the batch is dropped and its tracks are
+		// left for the next run
+		return
+	}
+
+	err := rw.write(batch)
+	if err != nil {
+		log.Println("[WRITER] Error", err.Error())
+		rw.mu.Lock()
+		rw.err = err
+		rw.mu.Unlock()
+		return
+	}
+
+	// The tracks only count as done once their rows made it to the output
+	if batch.checkpoint != nil {
+		if err := batch.checkpoint.RecordTracks(batch.done); err != nil {
+			log.Println("Error while writing the checkpoint file", err.Error())
+		}
+	}
+}
+
+// commitPending deduplicates the batches held back, artist by artist, and
+// commits them
+func (rw *rowWriter) commitPending() {
+	var sources []string
+	merged := make(map[string]*rowBatch)
+	for _, batch := range rw.pending {
+		m, ok := merged[batch.source]
+		if !ok {
+			sources = append(sources, batch.source)
+			m = &rowBatch{source: batch.source, checkpoint: batch.checkpoint}
+			merged[batch.source] = m
+		}
+		m.rows = append(m.rows, batch.rows...)
+		m.done = append(m.done, batch.done...)
+	}
+	rw.pending = nil
+
+	for _, source := range sources {
+		batch := merged[source]
+
+		var rows []utils.CatalogRow
+		var others []interface{}
+		for _, row := range batch.rows {
+			if r, ok := row.(utils.CatalogRow); ok {
+				rows = append(rows, r)
+			} else {
+				others = append(others, row)
+			}
+		}
+
+		deduped, err := utils.Dedup(rows, rw.dedup)
+		if err != nil {
+			log.Println("[WRITER] Cannot deduplicate rows", err.Error())
+			deduped = rows
+		}
+		if len(deduped) < len(rows) {
+			color.Yellow("[WRITER] Merged %d rows of %s into %d recordings", len(rows), source, len(deduped))
+		}
+
+		batch.rows = others
+		for _, row := range deduped {
+			batch.rows = append(batch.rows, row)
+		}
+		rw.commit(*batch)
+	}
+}
+
+// write writes and flushes the rows of a batch
+func (rw *rowWriter) write(batch rowBatch) error {
+	for _, row := range batch.rows {
+		if err := rw.w.Write(row); err != nil {
+			return err
+		}
+		rw.mu.Lock()
+		rw.rows[batch.source]++
+		rw.mu.Unlock()
+	}
+	return rw.w.Flush()
+}
+
+// Send queues a batch of rows to be written
+func (rw *rowWriter) Send(batch rowBatch) {
+	rw.batches <- batch
+}
+
+// Sync waits until every batch sent so far is written
+func (rw *rowWriter) Sync() {
+	synced := make(chan struct{})
+	rw.batches <- rowBatch{synced: synced}
+	<-synced
+}
+
+// Rows returns the number of rows written for an artist or playlist
+func (rw *rowWriter) Rows(source string) int {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	return rw.rows[source]
+}
+
+// Err returns the error that broke the output, if any
+func (rw *rowWriter) Err() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	return rw.err
+}
+
+// Close writes what is left and closes the output
+func (rw *rowWriter) Close() error {
+	close(rw.batches)
+	<-rw.done
+
+	err := rw.w.Close()
+	if err != nil {
+		log.Println("[WRITER] Error", err.Error())
+	}
+	if rw.err != nil {
+		return rw.err
+	}
+	return err
+}
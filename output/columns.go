@@ -0,0 +1,403 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// separator joins the elements of a list of plain values in a single cell
+const separator = "|"
+
+// Policies that turn the list a column path runs into into a single cell
+const (
+	// Join writes every element, separated by "|"
+	Join = "join"
+	// First writes the first element only
+	First = "first"
+	// Count writes the number of elements
+	Count = "count"
+)
+
+// Policies lists the ways of flattening a list into a cell
+var Policies = []string{Join, First, Count}
+
+// Column is a cell of a tabular row, named after the json tags on the way to
+// it, e.g. "album.release_date", or after the path it was picked by
+type Column struct {
+	name   string
+	steps  []step
+	policy string
+}
+
+// Name returns the header of the column
+func (c Column) Name() string {
+	return c.name
+}
+
+// step moves from a value to the next one along a column path
+type step struct {
+	// index is the field to take, nil when the step is about a list
+	index []int
+	// at is the element of a list to take, or -1 for all of them
+	at int
+}
+
+// ColumnsOf lists every column of row, the ones written when none are
+// picked
+func ColumnsOf(row interface{}) []Column {
+	return columnsOf(reflect.TypeOf(row))
+}
+
+// columnsOf lists the columns of a struct type. Nested structs are flattened
+// into a column per field, embedded structs lend their fields without a
+// prefix. Lists, maps and everything else become a single column.
+func columnsOf(t reflect.Type) []Column {
+	t = deref(t)
+	if t.Kind() != reflect.Struct {
+		return []Column{{name: "value"}}
+	}
+	return structColumns(t, "", nil)
+}
+
+func structColumns(t reflect.Type, prefix string, index []int) []Column {
+	var columns []Column
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		name := jsonName(field)
+		if name == "-" {
+			continue
+		}
+
+		fieldIndex := append(append([]int{}, index...), i)
+		fieldType := deref(field.Type)
+
+		if fieldType.Kind() == reflect.Struct {
+			childPrefix := prefix + name + "."
+			if field.Anonymous && field.Tag.Get("json") == "" {
+				childPrefix = prefix
+			}
+			columns = append(columns, structColumns(fieldType, childPrefix, fieldIndex)...)
+			continue
+		}
+
+		columns = append(columns, Column{name: prefix + name, steps: []step{{index: fieldIndex}}})
+	}
+	return columns
+}
+
+// ParseColumns picks columns of row by their paths. A path is made of json
+// field names separated by dots, e.g. "album.name" or "external_ids.isrc".
+// A list is indexed with "[n]", as in "artists[0].name", otherwise the rest
+// of the path is followed for every element. The resulting list is
+// flattened with the policy after a colon, "artists.name:count", and joined
+// when none is given.
+func ParseColumns(specs []string, row interface{}) ([]Column, error) {
+	t := reflect.TypeOf(row)
+	if t == nil || deref(t).Kind() != reflect.Struct {
+		return nil, fmt.Errorf("output: columns can only be picked from structs, not %T", row)
+	}
+
+	columns := make([]Column, 0, len(specs))
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		column, err := parseColumn(spec, t)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	if len(columns) < 1 {
+		return nil, fmt.Errorf("output: no columns given")
+	}
+	return columns, nil
+}
+
+func parseColumn(spec string, t reflect.Type) (Column, error) {
+	path := spec
+	policy := ""
+	if i := strings.LastIndex(spec, ":"); i >= 0 {
+		path, policy = spec[:i], strings.ToLower(spec[i+1:])
+		if !validPolicy(policy) {
+			return Column{}, fmt.Errorf("output: unknown policy %q in column %q, use one of %s",
+				policy, spec, strings.Join(Policies, ", "))
+		}
+	}
+
+	column := Column{name: spec, policy: policy}
+	for _, segment := range strings.Split(path, ".") {
+		name, positions, err := splitSegment(segment)
+		if err != nil {
+			return Column{}, fmt.Errorf("output: bad column %q: %v", spec, err)
+		}
+
+		// Fields of the elements of a list are taken from all of them
+		t = deref(t)
+		for isList(t) {
+			column.steps = append(column.steps, step{at: -1})
+			t = deref(t.Elem())
+		}
+		if t.Kind() != reflect.Struct {
+			return Column{}, fmt.Errorf("output: bad column %q: %s has no fields", spec, segment)
+		}
+
+		field, ok := fieldByName(t, name)
+		if !ok {
+			return Column{}, fmt.Errorf("output: bad column %q: there is no field %q", spec, name)
+		}
+		column.steps = append(column.steps, step{index: field.Index})
+		t = field.Type
+
+		for _, at := range positions {
+			t = deref(t)
+			if !isList(t) {
+				return Column{}, fmt.Errorf("output: bad column %q: %s is not a list", spec, name)
+			}
+			column.steps = append(column.steps, step{at: at})
+			t = t.Elem()
+		}
+	}
+
+	// A list at the end of the path is flattened by the policy, unless it
+	// holds structs and no policy was asked for, then it's written as JSON
+	t = deref(t)
+	if isList(t) && (policy != "" || plain(deref(t.Elem()))) {
+		column.steps = append(column.steps, step{at: -1})
+	}
+	return column, nil
+}
+
+// splitSegment splits "artists[0]" into the field name and list positions
+func splitSegment(segment string) (string, []int, error) {
+	name := segment
+	var positions []int
+	if i := strings.Index(segment, "["); i >= 0 {
+		name = segment[:i]
+		rest := segment[i:]
+		for rest != "" {
+			end := strings.Index(rest, "]")
+			if rest[0] != '[' || end < 0 {
+				return "", nil, fmt.Errorf("unbalanced brackets in %q", segment)
+			}
+			at, err := strconv.Atoi(rest[1:end])
+			if err != nil || at < 0 {
+				return "", nil, fmt.Errorf("%q is not a list position", rest[1:end])
+			}
+			positions = append(positions, at)
+			rest = rest[end+1:]
+		}
+	}
+	if name == "" {
+		return "", nil, fmt.Errorf("empty field name")
+	}
+	return name, positions, nil
+}
+
+// fieldByName finds the field going by name in JSON, looking through
+// embedded structs the same way encoding/json does
+func fieldByName(t reflect.Type, name string) (reflect.StructField, bool) {
+	var embedded []reflect.StructField
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		if field.Anonymous && field.Tag.Get("json") == "" && deref(field.Type).Kind() == reflect.Struct {
+			embedded = append(embedded, field)
+			continue
+		}
+		if jsonName(field) == name {
+			return field, true
+		}
+	}
+
+	for _, outer := range embedded {
+		if field, ok := fieldByName(deref(outer.Type), name); ok {
+			field.Index = append(append([]int{}, outer.Index...), field.Index...)
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// jsonName returns the name a field goes by in JSON
+func jsonName(field reflect.StructField) string {
+	tag := strings.Split(field.Tag.Get("json"), ",")[0]
+	if tag == "" {
+		return field.Name
+	}
+	return tag
+}
+
+// values formats the cells of a row
+func values(columns []Column, row interface{}) []string {
+	v := reflect.ValueOf(row)
+	cells := make([]string, len(columns))
+	for i, col := range columns {
+		cells[i] = col.value(v)
+	}
+	return cells
+}
+
+// value follows the column path from v and formats what it runs into
+func (c Column) value(v reflect.Value) string {
+	found := []reflect.Value{v}
+	list := false
+
+	for _, s := range c.steps {
+		var next []reflect.Value
+		for _, v := range found {
+			v, ok := indirect(v)
+			if !ok {
+				continue
+			}
+			switch {
+			case s.index != nil:
+				if v, ok := fieldByIndex(v, s.index); ok {
+					next = append(next, v)
+				}
+			case s.at < 0:
+				for i := 0; i < v.Len(); i++ {
+					next = append(next, v.Index(i))
+				}
+			case s.at < v.Len():
+				next = append(next, v.Index(s.at))
+			}
+		}
+		found = next
+		list = list || (s.index == nil && s.at < 0)
+	}
+
+	if !list {
+		if c.policy == Count {
+			return strconv.Itoa(len(found))
+		}
+		if len(found) < 1 {
+			return ""
+		}
+		return format(found[0])
+	}
+
+	switch c.policy {
+	case Count:
+		return strconv.Itoa(len(found))
+	case First:
+		if len(found) < 1 {
+			return ""
+		}
+		return format(found[0])
+	}
+	items := make([]string, len(found))
+	for i, v := range found {
+		items[i] = format(v)
+	}
+	return strings.Join(items, separator)
+}
+
+// fieldByIndex follows index into v, stopping short at nil pointers
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for _, i := range index {
+		var ok bool
+		if v, ok = indirect(v); !ok {
+			return v, false
+		}
+		v = v.Field(i)
+	}
+	return v, true
+}
+
+// indirect follows pointers and interfaces, reporting false at a nil one
+func indirect(v reflect.Value) (reflect.Value, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return v, false
+		}
+		v = v.Elem()
+	}
+	return v, v.IsValid()
+}
+
+// format turns a value into the text of a cell. Lists of plain values are
+// joined with separator, anything more involved is written as JSON.
+func format(v reflect.Value) string {
+	v, ok := indirect(v)
+	if !ok {
+		return ""
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Slice, reflect.Array:
+		if v.Len() == 0 {
+			return ""
+		}
+		if plain(v.Type().Elem()) {
+			items := make([]string, v.Len())
+			for i := range items {
+				items[i] = format(v.Index(i))
+			}
+			return strings.Join(items, separator)
+		}
+	}
+
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return fmt.Sprint(v.Interface())
+	}
+	return string(data)
+}
+
+// plain reports whether values of t fit in a cell as they are
+func plain(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// isList reports whether t is a slice or an array
+func isList(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice || t.Kind() == reflect.Array
+}
+
+// deref returns the type t points to
+func deref(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// validPolicy reports whether policy is one of Policies
+func validPolicy(policy string) bool {
+	for _, p := range Policies {
+		if p == policy {
+			return true
+		}
+	}
+	return false
+}
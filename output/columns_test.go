@@ -0,0 +1,105 @@
+package output
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shashankgroovy/morag/utils"
+)
+
+func TestColumnValues(t *testing.T) {
+	row := utils.CatalogRow{ArtistId: "artist"}
+	row.Id = "track"
+	row.Name = "Song"
+	row.Artists = []utils.SimplifiedArtist{{Id: "a1", Name: "First"}, {Id: "a2", Name: "Second"}}
+	row.AvailableMarkets = []string{"US", "SE", "DE"}
+	row.ExternalIds.Isrc = "USSM11300080"
+	row.Album.Name = "Album"
+
+	restricted := row
+	restricted.Restrictions = &utils.Restrictions{Reason: "market"}
+	restricted.LinkedFrom = &utils.LinkedTrack{Id: "original"}
+
+	tests := []struct {
+		spec string
+		row  utils.CatalogRow
+		want string
+	}{
+		{"name", row, "Song"},
+		{"artist_id", row, "artist"},
+		{"album.name", row, "Album"},
+		{"external_ids.isrc", row, "USSM11300080"},
+		{"artists[0].name", row, "First"},
+		{"artists[1].id", row, "a2"},
+		{"artists.name", row, "First|Second"},
+		{"artists.name:join", row, "First|Second"},
+		{"artists.name:first", row, "First"},
+		{"artists.name:count", row, "2"},
+		{"available_markets", row, "US|SE|DE"},
+		{"available_markets:count", row, "3"},
+		{"available_markets:first", row, "US"},
+		{"available_markets[1]", row, "SE"},
+
+		// Nil pointers on the way leave the cell empty
+		{"restrictions.reason", row, ""},
+		{"linked_from.id", row, ""},
+		{"restrictions.reason", restricted, "market"},
+		{"linked_from.id", restricted, "original"},
+
+		// Positions past the end of a list leave the cell empty
+		{"artists[5].name", row, ""},
+		{"available_markets[9]", row, ""},
+		{"artists[5].name:count", row, "0"},
+	}
+
+	for _, tt := range tests {
+		columns, err := ParseColumns([]string{tt.spec}, utils.CatalogRow{})
+		if err != nil {
+			t.Errorf("ParseColumns(%q) failed: %v", tt.spec, err)
+			continue
+		}
+		if name := columns[0].Name(); name != tt.spec {
+			t.Errorf("column %q is named %q", tt.spec, name)
+		}
+		if got := values(columns, tt.row)[0]; got != tt.want {
+			t.Errorf("column %q = %q, want %q", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseColumnsErrors(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"artists[0.name", "unbalanced brackets"},
+		{"artists0].name", "there is no field"},
+		{"artists[0]].name", "unbalanced brackets"},
+		{"artists[x].name", "is not a list position"},
+		{"artists[-1].name", "is not a list position"},
+		{"artists.name:last", "unknown policy"},
+		{"album.nickname", "there is no field"},
+		{"nickname", "there is no field"},
+		{"name[0]", "is not a list"},
+		{"name.length", "has no fields"},
+		{"album..name", "empty field name"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseColumns([]string{tt.spec}, utils.CatalogRow{})
+		if err == nil {
+			t.Errorf("ParseColumns(%q) succeeded, want an error", tt.spec)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseColumns(%q) = %q, want an error about %q", tt.spec, err, tt.want)
+		}
+	}
+
+	if _, err := ParseColumns([]string{" ", ""}, utils.CatalogRow{}); err == nil {
+		t.Error("ParseColumns with no columns succeeded")
+	}
+	if _, err := ParseColumns([]string{"name"}, "not a struct"); err == nil {
+		t.Error("ParseColumns on a string succeeded")
+	}
+}
@@ -0,0 +1,51 @@
+package output
+
+import (
+	"encoding/csv"
+	"io"
+	"reflect"
+)
+
+// delimitedWriter writes rows as CSV (RFC 4180) or TSV with a single header
+// row naming the columns
+type delimitedWriter struct {
+	w       *csv.Writer
+	header  bool
+	columns []Column
+}
+
+func newDelimitedWriter(w io.Writer, comma rune, crlf, header bool, columns []Column) *delimitedWriter {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	cw.UseCRLF = crlf
+	return &delimitedWriter{w: cw, header: header, columns: columns}
+}
+
+func (d *delimitedWriter) Write(row interface{}) error {
+	// Unless they were picked, the columns are worked out from the first row
+	if d.columns == nil {
+		d.columns = columnsOf(reflect.TypeOf(row))
+	}
+	if d.header {
+		d.header = false
+		names := make([]string, len(d.columns))
+		for i, col := range d.columns {
+			names[i] = col.Name()
+		}
+		if err := d.w.Write(names); err != nil {
+			return err
+		}
+	}
+
+	return d.w.Write(values(d.columns, row))
+}
+
+func (d *delimitedWriter) Flush() error {
+	d.w.Flush()
+	return d.w.Error()
+}
+
+func (d *delimitedWriter) Close() error {
+	d.w.Flush()
+	return d.w.Error()
+}
@@ -0,0 +1,136 @@
+package output
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// GraphFormats lists the formats a Graph can be written in
+var GraphFormats = []string{"edges", "graphml", "dot"}
+
+// Graph is a directed graph of artists, such as the one found by following
+// related artists
+type Graph struct {
+	Nodes []Node
+	Edges []Edge
+}
+
+// Node is an artist in a Graph. Depth is the number of steps it was found
+// away from where the graph started.
+type Node struct {
+	Id         string
+	Name       string
+	Depth      int
+	Popularity int
+	Followers  int
+	Genres     []string
+}
+
+// Edge points from an artist to one related to it
+type Edge struct {
+	Source string
+	Target string
+}
+
+// GraphExtension returns the file extension commonly used for a graph format
+func GraphExtension(format string) string {
+	switch strings.ToLower(format) {
+	case "edges":
+		return ".csv"
+	case "graphml":
+		return ".graphml"
+	}
+	return "." + strings.ToLower(format)
+}
+
+// WriteGraph writes g to w in one of GraphFormats: edges is a CSV file
+// with a row per edge, graphml and dot can be opened by Gephi, yEd or
+// Graphviz along with the names and depths of the artists.
+func WriteGraph(format string, w io.Writer, g *Graph) error {
+	switch strings.ToLower(format) {
+	case "edges":
+		return writeEdgeList(w, g)
+	case "graphml":
+		return writeGraphML(w, g)
+	case "dot":
+		return writeDOT(w, g)
+	}
+	return fmt.Errorf("output: unknown graph format %q, use one of %s", format, strings.Join(GraphFormats, ", "))
+}
+
+// names maps the ids of the nodes of g to their names
+func (g *Graph) names() map[string]string {
+	names := make(map[string]string, len(g.Nodes))
+	for _, node := range g.Nodes {
+		names[node.Id] = node.Name
+	}
+	return names
+}
+
+func writeEdgeList(w io.Writer, g *Graph) error {
+	names := g.names()
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"source", "target", "source_name", "target_name"})
+	for _, edge := range g.Edges {
+		cw.Write([]string{edge.Source, edge.Target, names[edge.Source], names[edge.Target]})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeGraphML(w io.Writer, g *Graph) error {
+	bw := bufio.NewWriter(w)
+	escape := func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+
+	bw.WriteString(xml.Header)
+	bw.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	bw.WriteString(`  <key id="name" for="node" attr.name="name" attr.type="string"/>` + "\n")
+	bw.WriteString(`  <key id="depth" for="node" attr.name="depth" attr.type="int"/>` + "\n")
+	bw.WriteString(`  <key id="popularity" for="node" attr.name="popularity" attr.type="int"/>` + "\n")
+	bw.WriteString(`  <key id="followers" for="node" attr.name="followers" attr.type="int"/>` + "\n")
+	bw.WriteString(`  <key id="genres" for="node" attr.name="genres" attr.type="string"/>` + "\n")
+	bw.WriteString(`  <graph id="related" edgedefault="directed">` + "\n")
+	for _, node := range g.Nodes {
+		fmt.Fprintf(bw, "    <node id=\"%s\">\n", escape(node.Id))
+		fmt.Fprintf(bw, "      <data key=\"name\">%s</data>\n", escape(node.Name))
+		fmt.Fprintf(bw, "      <data key=\"depth\">%d</data>\n", node.Depth)
+		fmt.Fprintf(bw, "      <data key=\"popularity\">%d</data>\n", node.Popularity)
+		fmt.Fprintf(bw, "      <data key=\"followers\">%d</data>\n", node.Followers)
+		fmt.Fprintf(bw, "      <data key=\"genres\">%s</data>\n", escape(strings.Join(node.Genres, ";")))
+		bw.WriteString("    </node>\n")
+	}
+	for i, edge := range g.Edges {
+		fmt.Fprintf(bw, "    <edge id=\"e%d\" source=\"%s\" target=\"%s\"/>\n", i, escape(edge.Source), escape(edge.Target))
+	}
+	bw.WriteString("  </graph>\n</graphml>\n")
+	return bw.Flush()
+}
+
+func writeDOT(w io.Writer, g *Graph) error {
+	bw := bufio.NewWriter(w)
+
+	bw.WriteString("digraph related {\n")
+	for _, node := range g.Nodes {
+		fmt.Fprintf(bw, "  %s [label=%s, depth=%d, popularity=%d];\n",
+			dotQuote(node.Id), dotQuote(node.Name), node.Depth, node.Popularity)
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(bw, "  %s -> %s;\n", dotQuote(edge.Source), dotQuote(edge.Target))
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+// dotQuote quotes s as a DOT identifier
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
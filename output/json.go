@@ -0,0 +1,103 @@
+package output
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+// jsonWriter writes rows as a single pretty printed JSON array. When the
+// output can seek, every Flush closes the array and the next row is written
+// over the closing bracket, so the file holds valid JSON even if the run
+// dies before Close. Otherwise the array is only closed by Close.
+type jsonWriter struct {
+	w      *bufio.Writer
+	seeker io.Seeker
+	rows   int
+}
+
+func newJSONWriter(w io.Writer) *jsonWriter {
+	j := &jsonWriter{w: bufio.NewWriter(w)}
+	// Pipes and terminals claim to seek but fail when asked to
+	if s, ok := w.(io.Seeker); ok {
+		if _, err := s.Seek(0, io.SeekCurrent); err == nil {
+			j.seeker = s
+		}
+	}
+	return j
+}
+
+func (j *jsonWriter) Write(row interface{}) error {
+	data, err := json.MarshalIndent(row, "  ", "  ")
+	if err != nil {
+		return err
+	}
+
+	separator := ",\n  "
+	if j.rows == 0 {
+		separator = "[\n  "
+	}
+	j.rows++
+
+	if _, err := j.w.WriteString(separator); err != nil {
+		return err
+	}
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonWriter) Flush() error {
+	if j.seeker == nil {
+		return j.w.Flush()
+	}
+
+	// Close the array and step back over the bracket for the next row
+	closing := j.closing()
+	if _, err := j.w.WriteString(closing); err != nil {
+		return err
+	}
+	if err := j.w.Flush(); err != nil {
+		return err
+	}
+	_, err := j.seeker.Seek(-int64(len(closing)), io.SeekCurrent)
+	return err
+}
+
+func (j *jsonWriter) Close() error {
+	if _, err := j.w.WriteString(j.closing()); err != nil {
+		return err
+	}
+	return j.w.Flush()
+}
+
+// closing returns what ends the array after the rows written so far
+func (j *jsonWriter) closing() string {
+	if j.rows == 0 {
+		return "[]\n"
+	}
+	return "\n]\n"
+}
+
+// ndjsonWriter writes every row as a JSON object on a line of its own, which
+// makes the output easy to stream and to append to
+type ndjsonWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	bw := bufio.NewWriter(w)
+	return &ndjsonWriter{w: bw, enc: json.NewEncoder(bw)}
+}
+
+func (n *ndjsonWriter) Write(row interface{}) error {
+	return n.enc.Encode(row)
+}
+
+func (n *ndjsonWriter) Flush() error {
+	return n.w.Flush()
+}
+
+func (n *ndjsonWriter) Close() error {
+	return n.w.Flush()
+}
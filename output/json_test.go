@@ -0,0 +1,65 @@
+package output
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSONWriterValidAfterFlush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "morag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.json")
+
+	w, err := Create("json", path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type row struct {
+		Id string `json:"id"`
+	}
+	read := func() []row {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rows []row
+		if err := json.Unmarshal(data, &rows); err != nil {
+			t.Fatalf("invalid JSON %q: %v", data, err)
+		}
+		return rows
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if rows := read(); len(rows) != 0 {
+		t.Errorf("got %d rows before any was written", len(rows))
+	}
+
+	for i, id := range []string{"a", "b", "c"} {
+		if err := w.Write(row{id}); err != nil {
+			t.Fatal(err)
+		}
+		// Left unclosed as if the run died here
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if rows := read(); len(rows) != i+1 || rows[i].Id != id {
+			t.Errorf("got %v after writing %s", rows, id)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if rows := read(); len(rows) != 3 {
+		t.Errorf("got %v after Close", rows)
+	}
+}
@@ -0,0 +1,131 @@
+// Package output writes fetched rows to a file in one of several formats.
+// Rows are structs, their columns are derived from the json tags of the
+// struct's fields.
+package output
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Writer writes rows, all of the same struct type, to an output
+type Writer interface {
+	// Write adds a single row to the output
+	Write(row interface{}) error
+
+	// Flush writes out whatever rows are buffered
+	Flush() error
+
+	// Close flushes whatever is buffered and closes the output
+	Close() error
+}
+
+// Formats lists the supported output formats
+var Formats = []string{"csv", "tsv", "json", "ndjson", "sqlite"}
+
+// Options changes how an output file is written
+type Options struct {
+	// Append adds rows to the end of an existing file instead of
+	// replacing it. A header is only written when the file is empty. A
+	// SQLite database is never replaced, rows are always upserted.
+	Append bool
+
+	// Columns picks the columns of tabular formats, all fields of a row
+	// are written when it's empty. See ParseColumns.
+	Columns []Column
+}
+
+// Extension returns the file extension commonly used for a format
+func Extension(format string) string {
+	return "." + strings.ToLower(format)
+}
+
+// Create opens the file at path and returns a Writer for the given format
+func Create(format, path string, opt Options) (Writer, error) {
+	format = strings.ToLower(format)
+	if !supported(format) {
+		return nil, fmt.Errorf("output: unknown format %q, use one of %s", format, strings.Join(Formats, ", "))
+	}
+	if len(opt.Columns) > 0 && !Tabular(format) {
+		return nil, fmt.Errorf("output: columns can only be picked for csv and tsv, not %s", format)
+	}
+	if format == "sqlite" {
+		return newSQLiteWriter(path)
+	}
+
+	flags := os.O_CREATE | os.O_TRUNC | os.O_WRONLY
+	if opt.Append {
+		flags = os.O_CREATE | os.O_APPEND | os.O_WRONLY
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	empty := true
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		empty = false
+	}
+	if !empty && format == "json" {
+		file.Close()
+		return nil, fmt.Errorf("output: can't append to the JSON array in %s, use the ndjson format instead", path)
+	}
+
+	w, err := New(format, file, empty, opt.Columns)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &fileWriter{Writer: w, file: file}, nil
+}
+
+// New returns a Writer for the given format that writes to w. header tells
+// tabular formats whether to start with a header row, columns which columns
+// to write (all of them when nil).
+func New(format string, w io.Writer, header bool, columns []Column) (Writer, error) {
+	switch strings.ToLower(format) {
+	case "csv":
+		return newDelimitedWriter(w, ',', true, header, columns), nil
+	case "tsv":
+		return newDelimitedWriter(w, '\t', false, header, columns), nil
+	case "json":
+		return newJSONWriter(w), nil
+	case "ndjson":
+		return newNDJSONWriter(w), nil
+	case "sqlite":
+		return nil, fmt.Errorf("output: the sqlite format can only be written to a file")
+	}
+	return nil, fmt.Errorf("output: unknown format %q, use one of %s", format, strings.Join(Formats, ", "))
+}
+
+// Tabular reports whether format writes rows as cells under a header
+func Tabular(format string) bool {
+	format = strings.ToLower(format)
+	return format == "csv" || format == "tsv"
+}
+
+// supported reports whether format is one of Formats
+func supported(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// fileWriter closes the underlying file along with the Writer
+type fileWriter struct {
+	Writer
+	file *os.File
+}
+
+func (f *fileWriter) Close() error {
+	err := f.Writer.Close()
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,635 @@
+package output
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/shashankgroovy/morag/utils"
+
+	// registers the sqlite3 driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteSchema normalizes catalog rows into a table per kind of object, all
+// keyed on Spotify ids so that fetching again updates rows in place
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS artists (
+	id          TEXT PRIMARY KEY,
+	name        TEXT,
+	followers   INTEGER,
+	popularity  INTEGER,
+	uri         TEXT,
+	href        TEXT,
+	spotify_url TEXT
+);
+
+CREATE TABLE IF NOT EXISTS artist_genres (
+	artist_id TEXT NOT NULL REFERENCES artists(id),
+	genre     TEXT NOT NULL,
+	PRIMARY KEY (artist_id, genre)
+);
+
+CREATE TABLE IF NOT EXISTS artist_images (
+	artist_id TEXT NOT NULL REFERENCES artists(id),
+	url       TEXT NOT NULL,
+	position  INTEGER,
+	PRIMARY KEY (artist_id, url)
+);
+
+CREATE TABLE IF NOT EXISTS albums (
+	id                     TEXT PRIMARY KEY,
+	name                   TEXT,
+	album_type             TEXT,
+	release_date           TEXT,
+	release_date_precision TEXT,
+	total_tracks           INTEGER,
+	label                  TEXT,
+	popularity             INTEGER,
+	upc                    TEXT,
+	ean                    TEXT,
+	uri                    TEXT,
+	href                   TEXT,
+	spotify_url            TEXT
+);
+
+CREATE TABLE IF NOT EXISTS album_genres (
+	album_id TEXT NOT NULL REFERENCES albums(id),
+	genre    TEXT NOT NULL,
+	PRIMARY KEY (album_id, genre)
+);
+
+CREATE TABLE IF NOT EXISTS album_copyrights (
+	album_id TEXT NOT NULL REFERENCES albums(id),
+	type     TEXT NOT NULL,
+	text     TEXT NOT NULL,
+	PRIMARY KEY (album_id, type, text)
+);
+
+CREATE TABLE IF NOT EXISTS artist_albums (
+	artist_id   TEXT NOT NULL,
+	album_id    TEXT NOT NULL REFERENCES albums(id),
+	album_group TEXT,
+	PRIMARY KEY (artist_id, album_id)
+);
+
+CREATE TABLE IF NOT EXISTS album_artists (
+	album_id  TEXT NOT NULL REFERENCES albums(id),
+	artist_id TEXT NOT NULL REFERENCES artists(id),
+	position  INTEGER,
+	PRIMARY KEY (album_id, artist_id)
+);
+
+CREATE TABLE IF NOT EXISTS album_images (
+	album_id TEXT NOT NULL REFERENCES albums(id),
+	url      TEXT NOT NULL,
+	width    INTEGER,
+	height   INTEGER,
+	PRIMARY KEY (album_id, url)
+);
+
+CREATE TABLE IF NOT EXISTS tracks (
+	id           TEXT PRIMARY KEY,
+	album_id     TEXT REFERENCES albums(id),
+	name         TEXT,
+	disc_number  INTEGER,
+	track_number INTEGER,
+	duration_ms  INTEGER,
+	explicit     INTEGER,
+	popularity   INTEGER,
+	isrc         TEXT,
+	ean          TEXT,
+	upc          TEXT,
+	market       TEXT,
+	is_playable  INTEGER,
+	restriction  TEXT,
+	linked_from  TEXT,
+	is_local     INTEGER,
+	preview_url  TEXT,
+	uri          TEXT,
+	href         TEXT,
+	spotify_url  TEXT
+);
+
+CREATE TABLE IF NOT EXISTS track_artists (
+	track_id  TEXT NOT NULL REFERENCES tracks(id),
+	artist_id TEXT NOT NULL REFERENCES artists(id),
+	position  INTEGER,
+	PRIMARY KEY (track_id, artist_id)
+);
+
+CREATE TABLE IF NOT EXISTS track_alternates (
+	track_id     TEXT NOT NULL REFERENCES tracks(id),
+	alternate_id TEXT NOT NULL,
+	PRIMARY KEY (track_id, alternate_id)
+);
+
+CREATE TABLE IF NOT EXISTS playlist_tracks (
+	playlist_id TEXT NOT NULL,
+	position    INTEGER NOT NULL,
+	track_id    TEXT REFERENCES tracks(id),
+	name        TEXT,
+	type        TEXT,
+	added_at    TEXT,
+	added_by    TEXT,
+	PRIMARY KEY (playlist_id, position)
+);
+
+CREATE TABLE IF NOT EXISTS library (
+	object_type TEXT NOT NULL,
+	object_id   TEXT NOT NULL,
+	added_at    TEXT,
+	PRIMARY KEY (object_type, object_id)
+);
+
+CREATE TABLE IF NOT EXISTS markets (
+	object_type TEXT NOT NULL,
+	object_id   TEXT NOT NULL,
+	market      TEXT NOT NULL,
+	PRIMARY KEY (object_type, object_id, market)
+);
+
+CREATE TABLE IF NOT EXISTS audio_features (
+	track_id         TEXT PRIMARY KEY REFERENCES tracks(id),
+	acousticness     REAL,
+	danceability     REAL,
+	energy           REAL,
+	instrumentalness REAL,
+	key              INTEGER,
+	liveness         REAL,
+	loudness         REAL,
+	mode             INTEGER,
+	speechiness      REAL,
+	tempo            REAL,
+	time_signature   INTEGER,
+	valence          REAL,
+	duration_ms      INTEGER,
+	analysis_url     TEXT
+);
+
+CREATE INDEX IF NOT EXISTS tracks_album_id ON tracks (album_id);
+CREATE INDEX IF NOT EXISTS tracks_isrc ON tracks (isrc);
+CREATE INDEX IF NOT EXISTS track_artists_artist_id ON track_artists (artist_id);
+`
+
+// sqliteWriter upserts rows into a SQLite database. Rows are written in a
+// transaction that is committed on every Flush.
+type sqliteWriter struct {
+	db *sql.DB
+	tx *sql.Tx
+
+	// playlists holds the playlists whose earlier items were cleared,
+	// cleared those of them cleared by the open transaction
+	playlists map[string]bool
+	cleared   []string
+}
+
+func newSQLiteWriter(path string) (*sqliteWriter, error) {
+	db, err := sql.Open("sqlite3", path+"?_foreign_keys=off")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("output: could not set up %s: %v", path, err)
+	}
+	return &sqliteWriter{db: db, playlists: make(map[string]bool)}, nil
+}
+
+// Write upserts a row. If that fails, every row written since the last
+// Flush is rolled back rather than committed half way.
+func (s *sqliteWriter) Write(row interface{}) error {
+	if s.tx == nil {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		s.tx = tx
+	}
+
+	err := s.write(row)
+	if err != nil {
+		s.rollback()
+	}
+	return err
+}
+
+func (s *sqliteWriter) write(row interface{}) error {
+	switch row := row.(type) {
+	case utils.CatalogRow:
+		return s.writeCatalogRow(row)
+	case *utils.CatalogRow:
+		return s.writeCatalogRow(*row)
+	case utils.FullSoundtrack:
+		return s.writeTrack(row, "")
+	case utils.PlaylistRow:
+		return s.writePlaylistRow(row)
+	case utils.ArtistRow:
+		return s.writeArtistRow(row)
+	case utils.FullArtist:
+		return s.writeArtistRow(row.Row())
+	case utils.SavedTrackRow:
+		if err := s.writeTrack(row.FullSoundtrack, row.Market); err != nil {
+			return err
+		}
+		return s.writeLibrary("track", row.Id, row.AddedAt)
+	case utils.SavedAlbumRow:
+		if err := s.writeAlbum(row.SimplifiedAlbum); err != nil {
+			return err
+		}
+		if err := s.writeAlbumDetails(row.Id, &row.AlbumDetails); err != nil {
+			return err
+		}
+		return s.writeLibrary("album", row.Id, row.AddedAt)
+	case utils.FollowedArtistRow:
+		if err := s.writeArtistRow(row.ArtistRow); err != nil {
+			return err
+		}
+		return s.writeLibrary("artist", row.Id, "")
+	case utils.AlbumRow:
+		if err := s.writeAlbum(row.SimplifiedAlbum); err != nil {
+			return err
+		}
+		if err := s.writeArtistAlbum(row.ArtistId, row.SimplifiedAlbum); err != nil {
+			return err
+		}
+		return s.writeAlbumDetails(row.Id, &row.AlbumDetails)
+	}
+	return fmt.Errorf("output: the sqlite format can't store rows of type %T", row)
+}
+
+// writeCatalogRow upserts a track along with whatever extras it carries
+func (s *sqliteWriter) writeCatalogRow(row utils.CatalogRow) error {
+	if err := s.writeTrack(row.FullSoundtrack, row.Market); err != nil {
+		return err
+	}
+	if err := s.writeArtistAlbum(row.ArtistId, row.Album); err != nil {
+		return err
+	}
+	for _, id := range row.AlternateIds {
+		if _, err := s.tx.Exec(`INSERT OR IGNORE INTO track_alternates (track_id, alternate_id) VALUES (?, ?)`,
+			row.Id, id); err != nil {
+			return err
+		}
+	}
+	if err := s.writeAlbumDetails(row.Album.Id, row.AlbumDetails); err != nil {
+		return err
+	}
+	return s.writeAudioFeatures(row.AudioFeatures)
+}
+
+// writePlaylistRow upserts a track along with its place in the playlist.
+// Local files and episodes are listed in the playlist without a track. The
+// first item written for a playlist replaces whatever was listed for it
+// before, so items removed since are dropped.
+func (s *sqliteWriter) writePlaylistRow(row utils.PlaylistRow) error {
+	if !s.playlists[row.PlaylistId] {
+		if _, err := s.tx.Exec(`DELETE FROM playlist_tracks WHERE playlist_id = ?`, row.PlaylistId); err != nil {
+			return err
+		}
+		s.playlists[row.PlaylistId] = true
+		s.cleared = append(s.cleared, row.PlaylistId)
+	}
+
+	var trackID string
+	if row.Type == "track" && !row.IsLocal {
+		if err := s.writeTrack(row.FullSoundtrack, row.Market); err != nil {
+			return err
+		}
+		trackID = row.Id
+	}
+	_, err := s.tx.Exec(`
+		INSERT INTO playlist_tracks (playlist_id, position, track_id, name, type, added_at, added_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (playlist_id, position) DO UPDATE SET
+			track_id = excluded.track_id,
+			name = excluded.name,
+			type = excluded.type,
+			added_at = excluded.added_at,
+			added_by = excluded.added_by`,
+		row.PlaylistId, row.Position, nullable(trackID), row.Name, row.Type, nullable(row.AddedAt), nullable(row.AddedBy))
+	return err
+}
+
+// writeTrack upserts a track along with its album and artists. market is
+// where the playability of the track was checked, if anywhere.
+func (s *sqliteWriter) writeTrack(track utils.FullSoundtrack, market string) error {
+	if track.Id == "" {
+		// Local files have no id to key them on
+		return nil
+	}
+
+	album := track.Album
+	if album.Id != "" {
+		if err := s.writeAlbum(album); err != nil {
+			return err
+		}
+	}
+
+	var restriction, linkedFrom string
+	if track.Restrictions != nil {
+		restriction = track.Restrictions.Reason
+	}
+	if track.LinkedFrom != nil {
+		linkedFrom = track.LinkedFrom.Id
+	}
+
+	_, err := s.tx.Exec(`
+		INSERT INTO tracks (id, album_id, name, disc_number, track_number, duration_ms, explicit, popularity,
+			isrc, ean, upc, market, is_playable, restriction, linked_from, is_local, preview_url, uri, href, spotify_url)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			album_id = excluded.album_id,
+			name = excluded.name,
+			disc_number = excluded.disc_number,
+			track_number = excluded.track_number,
+			duration_ms = excluded.duration_ms,
+			explicit = excluded.explicit,
+			popularity = excluded.popularity,
+			isrc = excluded.isrc,
+			ean = excluded.ean,
+			upc = excluded.upc,
+			market = excluded.market,
+			is_playable = excluded.is_playable,
+			restriction = excluded.restriction,
+			linked_from = excluded.linked_from,
+			is_local = excluded.is_local,
+			preview_url = excluded.preview_url,
+			uri = excluded.uri,
+			href = excluded.href,
+			spotify_url = excluded.spotify_url`,
+		track.Id, nullable(album.Id), track.Name, track.DiscNumber, track.TrackNumber, track.DurationMs,
+		track.Explicit, track.Popularity, track.ExternalIds.Isrc, track.ExternalIds.Ean, track.ExternalIds.Upc,
+		nullable(market), track.IsPlayable, nullable(restriction), nullable(linkedFrom), track.IsLocal, track.PreviewUrl, track.Uri, track.Href, track.ExternalUrls.Spotify)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.tx.Exec(`DELETE FROM track_artists WHERE track_id = ?`, track.Id); err != nil {
+		return err
+	}
+	for i, artist := range track.Artists {
+		if err := s.writeArtist(artist); err != nil {
+			return err
+		}
+		if _, err := s.tx.Exec(`INSERT OR REPLACE INTO track_artists (track_id, artist_id, position) VALUES (?, ?, ?)`,
+			track.Id, artist.Id, i); err != nil {
+			return err
+		}
+	}
+
+	return s.writeMarkets("track", track.Id, track.AvailableMarkets)
+}
+
+// writeAlbum upserts an album along with its artists, images and markets
+func (s *sqliteWriter) writeAlbum(album utils.SimplifiedAlbum) error {
+	_, err := s.tx.Exec(`
+		INSERT INTO albums (id, name, album_type, release_date, release_date_precision, total_tracks, uri, href, spotify_url)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			name = excluded.name,
+			album_type = excluded.album_type,
+			release_date = excluded.release_date,
+			release_date_precision = excluded.release_date_precision,
+			total_tracks = excluded.total_tracks,
+			uri = excluded.uri,
+			href = excluded.href,
+			spotify_url = excluded.spotify_url`,
+		album.Id, album.Name, album.AlbumType, album.ReleaseDate, album.ReleaseDatePrecision, album.TotalTracks,
+		album.Uri, album.Href, album.ExternalUrls.Spotify)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.tx.Exec(`DELETE FROM album_artists WHERE album_id = ?`, album.Id); err != nil {
+		return err
+	}
+	for i, artist := range album.Artists {
+		if err := s.writeArtist(artist); err != nil {
+			return err
+		}
+		if _, err := s.tx.Exec(`INSERT OR REPLACE INTO album_artists (album_id, artist_id, position) VALUES (?, ?, ?)`,
+			album.Id, artist.Id, i); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.tx.Exec(`DELETE FROM album_images WHERE album_id = ?`, album.Id); err != nil {
+		return err
+	}
+	for _, image := range album.Images {
+		if _, err := s.tx.Exec(`INSERT OR REPLACE INTO album_images (album_id, url, width, height) VALUES (?, ?, ?, ?)`,
+			album.Id, image.Url, image.Width, image.Height); err != nil {
+			return err
+		}
+	}
+
+	return s.writeMarkets("album", album.Id, album.AvailableMarkets)
+}
+
+// writeArtistAlbum records an album as part of the catalog of the artist it
+// was listed for
+func (s *sqliteWriter) writeArtistAlbum(artistID string, album utils.SimplifiedAlbum) error {
+	if artistID == "" || album.Id == "" {
+		return nil
+	}
+	_, err := s.tx.Exec(`
+		INSERT INTO artist_albums (artist_id, album_id, album_group)
+		VALUES (?, ?, ?)
+		ON CONFLICT (artist_id, album_id) DO UPDATE SET
+			album_group = excluded.album_group`,
+		artistID, album.Id, nullable(album.AlbumGroup))
+	return err
+}
+
+// writeAlbumDetails fills in the details of an album written before
+func (s *sqliteWriter) writeAlbumDetails(albumID string, details *utils.AlbumDetails) error {
+	if details == nil || albumID == "" {
+		return nil
+	}
+	_, err := s.tx.Exec(`UPDATE albums SET label = ?, popularity = ?, upc = ?, ean = ? WHERE id = ?`,
+		details.Label, details.Popularity, details.ExternalIds.Upc, details.ExternalIds.Ean, albumID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.tx.Exec(`DELETE FROM album_genres WHERE album_id = ?`, albumID); err != nil {
+		return err
+	}
+	for _, genre := range details.Genres {
+		if _, err := s.tx.Exec(`INSERT OR IGNORE INTO album_genres (album_id, genre) VALUES (?, ?)`,
+			albumID, genre); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.tx.Exec(`DELETE FROM album_copyrights WHERE album_id = ?`, albumID); err != nil {
+		return err
+	}
+	for _, copyright := range details.Copyrights {
+		if _, err := s.tx.Exec(`INSERT OR IGNORE INTO album_copyrights (album_id, type, text) VALUES (?, ?, ?)`,
+			albumID, copyright.Type, copyright.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeArtist upserts a simplified artist
+func (s *sqliteWriter) writeArtist(artist utils.SimplifiedArtist) error {
+	if artist.Id == "" {
+		return nil
+	}
+	_, err := s.tx.Exec(`
+		INSERT INTO artists (id, name, uri, href, spotify_url)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			name = excluded.name,
+			uri = excluded.uri,
+			href = excluded.href,
+			spotify_url = excluded.spotify_url`,
+		artist.Id, artist.Name, artist.Uri, artist.Href, artist.ExternalUrls.Spotify)
+	return err
+}
+
+// writeAudioFeatures upserts the audio features of a track
+func (s *sqliteWriter) writeAudioFeatures(f *utils.AudioFeatures) error {
+	if f == nil || f.Id == "" {
+		return nil
+	}
+	_, err := s.tx.Exec(`
+		INSERT INTO audio_features (track_id, acousticness, danceability, energy, instrumentalness, key, liveness,
+			loudness, mode, speechiness, tempo, time_signature, valence, duration_ms, analysis_url)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (track_id) DO UPDATE SET
+			acousticness = excluded.acousticness,
+			danceability = excluded.danceability,
+			energy = excluded.energy,
+			instrumentalness = excluded.instrumentalness,
+			key = excluded.key,
+			liveness = excluded.liveness,
+			loudness = excluded.loudness,
+			mode = excluded.mode,
+			speechiness = excluded.speechiness,
+			tempo = excluded.tempo,
+			time_signature = excluded.time_signature,
+			valence = excluded.valence,
+			duration_ms = excluded.duration_ms,
+			analysis_url = excluded.analysis_url`,
+		f.Id, f.Acousticness, f.Danceability, f.Energy, f.Instrumentalness, f.Key, f.Liveness,
+		f.Loudness, f.Mode, f.Speechiness, f.Tempo, f.TimeSignature, f.Valence, f.DurationMs, f.AnalysisUrl)
+	return err
+}
+
+// writeArtistRow upserts an artist along with its genres and images
+func (s *sqliteWriter) writeArtistRow(artist utils.ArtistRow) error {
+	if artist.Id == "" {
+		return nil
+	}
+	_, err := s.tx.Exec(`
+		INSERT INTO artists (id, name, followers, popularity, uri, spotify_url)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			name = excluded.name,
+			followers = excluded.followers,
+			popularity = excluded.popularity,
+			uri = excluded.uri,
+			spotify_url = excluded.spotify_url`,
+		artist.Id, artist.Name, artist.Followers, artist.Popularity, artist.Uri, artist.SpotifyUrl)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.tx.Exec(`DELETE FROM artist_genres WHERE artist_id = ?`, artist.Id); err != nil {
+		return err
+	}
+	for _, genre := range artist.Genres {
+		if _, err := s.tx.Exec(`INSERT OR IGNORE INTO artist_genres (artist_id, genre) VALUES (?, ?)`,
+			artist.Id, genre); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.tx.Exec(`DELETE FROM artist_images WHERE artist_id = ?`, artist.Id); err != nil {
+		return err
+	}
+	for i, url := range artist.ImageUrls {
+		if _, err := s.tx.Exec(`INSERT OR IGNORE INTO artist_images (artist_id, url, position) VALUES (?, ?, ?)`,
+			artist.Id, url, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeLibrary records an object as saved or followed by the current user
+func (s *sqliteWriter) writeLibrary(objectType, objectID, addedAt string) error {
+	if objectID == "" {
+		return nil
+	}
+	_, err := s.tx.Exec(`
+		INSERT INTO library (object_type, object_id, added_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (object_type, object_id) DO UPDATE SET
+			added_at = excluded.added_at`,
+		objectType, objectID, nullable(addedAt))
+	return err
+}
+
+// writeMarkets replaces the markets an object is available in. Spotify
+// leaves them out of objects looked up in a market, those markets are kept.
+func (s *sqliteWriter) writeMarkets(objectType, objectID string, markets []string) error {
+	if markets == nil {
+		return nil
+	}
+	if _, err := s.tx.Exec(`DELETE FROM markets WHERE object_type = ? AND object_id = ?`, objectType, objectID); err != nil {
+		return err
+	}
+	for _, market := range markets {
+		if _, err := s.tx.Exec(`INSERT OR IGNORE INTO markets (object_type, object_id, market) VALUES (?, ?, ?)`,
+			objectType, objectID, market); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteWriter) Flush() error {
+	if s.tx == nil {
+		return nil
+	}
+	err := s.tx.Commit()
+	if err != nil {
+		for _, id := range s.cleared {
+			delete(s.playlists, id)
+		}
+	}
+	s.tx = nil
+	s.cleared = nil
+	return err
+}
+
+// rollback drops the open transaction along with what it cleared
+func (s *sqliteWriter) rollback() {
+	s.tx.Rollback()
+	s.tx = nil
+	for _, id := range s.cleared {
+		delete(s.playlists, id)
+	}
+	s.cleared = nil
+}
+
+func (s *sqliteWriter) Close() error {
+	err := s.Flush()
+	if closeErr := s.db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// nullable stores empty strings as NULL
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,70 @@
+package output
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shashankgroovy/morag/utils"
+)
+
+func TestSQLiteWriterRollsBackOnError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "morag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "catalog.db")
+
+	w, err := Create("sqlite", path, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	track := func(id string) utils.CatalogRow {
+		row := utils.CatalogRow{ArtistId: "artist"}
+		row.Id = id
+		row.Name = "Track " + id
+		return row
+	}
+
+	if err := w.Write(track("committed")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Write(track("rolled-back")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(struct{}{}); err == nil {
+		t.Fatal("writing an unknown row type succeeded")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var ids []string
+	rows, err := db.Query(`SELECT id FROM tracks ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	if len(ids) != 1 || ids[0] != "committed" {
+		t.Errorf("tracks = %v, want only the committed one", ids)
+	}
+}
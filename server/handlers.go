@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
 
 	"github.com/shashankgroovy/morag/utils"
 )
@@ -16,6 +17,19 @@ var clientId string = os.Getenv("CLIENT_ID")
 var clientSecret string = os.Getenv("CLIENT_SECRET")
 var redirectURI string = fmt.Sprintf("%s:%s/auth/callback", os.Getenv("BASE_URI"), os.Getenv("PORT"))
 
+// DefaultScopes are the permissions asked for on login: the user's country,
+// their library, the artists they follow and their private playlists
+var DefaultScopes = []string{
+	"user-read-currently-playing",
+	"user-read-private",
+	"user-library-read",
+	"user-follow-read",
+	"playlist-read-private",
+}
+
+// Scopes are the permissions the login page asks for
+var Scopes = DefaultScopes
+
 // controller for health check
 func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -31,7 +45,7 @@ func authHandler(w http.ResponseWriter, r *http.Request) {
 		ClientId    string
 		Scopes      string
 		RedirectURI string
-	}{clientId, "user-read-currently-playing", redirectURI}
+	}{clientId, strings.Join(Scopes, " "), redirectURI}
 	tmpl.Execute(w, data)
 }
 
@@ -0,0 +1,58 @@
+package spotify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/shashankgroovy/morag/utils"
+)
+
+// MaxAlbumIDs is the largest number of ids accepted by Albums
+const MaxAlbumIDs = 20
+
+// ArtistAlbums returns one page of an artist's albums
+func (c *Client) ArtistAlbums(ctx context.Context, artistID string, opt *Options) (*utils.AlbumPage, error) {
+	var page utils.AlbumPage
+	path := fmt.Sprintf("/artists/%s/albums", artistID)
+	if err := c.get(ctx, path, opt.values(), &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// AlbumTracks returns one page of an album's tracks
+func (c *Client) AlbumTracks(ctx context.Context, albumID string, opt *Options) (*utils.SoundtrackPage, error) {
+	var page utils.SoundtrackPage
+	path := fmt.Sprintf("/albums/%s/tracks", albumID)
+	if err := c.get(ctx, path, opt.values(), &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// Albums returns the full album objects of up to MaxAlbumIDs albums in a
+// single request. Ids unknown to Spotify are left out of the result. Given a
+// market, the tracks of the albums are relinked as described for Tracks.
+func (c *Client) Albums(ctx context.Context, albumIDs []string, market string) ([]utils.FullAlbum, error) {
+	if len(albumIDs) > MaxAlbumIDs {
+		return nil, fmt.Errorf("spotify: at most %d album ids per request, got %d", MaxAlbumIDs, len(albumIDs))
+	}
+
+	var result struct {
+		Albums []*utils.FullAlbum `json:"albums"`
+	}
+	q := marketQuery(market)
+	q.Set("ids", strings.Join(albumIDs, ","))
+	if err := c.get(ctx, "/albums", q, &result); err != nil {
+		return nil, err
+	}
+
+	albums := make([]utils.FullAlbum, 0, len(result.Albums))
+	for _, album := range result.Albums {
+		if album != nil {
+			albums = append(albums, *album)
+		}
+	}
+	return albums, nil
+}
@@ -0,0 +1,59 @@
+package spotify
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/shashankgroovy/morag/utils"
+)
+
+// MaxArtistIDs is the largest number of ids accepted by Artists
+const MaxArtistIDs = 50
+
+// Artist returns the full artist object of a single artist
+func (c *Client) Artist(ctx context.Context, artistID string) (*utils.FullArtist, error) {
+	var artist utils.FullArtist
+	if err := c.get(ctx, "/artists/"+artistID, nil, &artist); err != nil {
+		return nil, err
+	}
+	return &artist, nil
+}
+
+// Artists returns the full artist objects of up to MaxArtistIDs artists in a
+// single request. Ids unknown to Spotify are left out of the result.
+func (c *Client) Artists(ctx context.Context, artistIDs []string) ([]utils.FullArtist, error) {
+	if len(artistIDs) > MaxArtistIDs {
+		return nil, fmt.Errorf("spotify: at most %d artist ids per request, got %d", MaxArtistIDs, len(artistIDs))
+	}
+
+	var result struct {
+		Artists []*utils.FullArtist `json:"artists"`
+	}
+	q := url.Values{}
+	q.Set("ids", strings.Join(artistIDs, ","))
+	if err := c.get(ctx, "/artists", q, &result); err != nil {
+		return nil, err
+	}
+
+	artists := make([]utils.FullArtist, 0, len(result.Artists))
+	for _, artist := range result.Artists {
+		if artist != nil {
+			artists = append(artists, *artist)
+		}
+	}
+	return artists, nil
+}
+
+// RelatedArtists returns up to 20 artists similar to the given one, as
+// judged by the listening history of Spotify's users
+func (c *Client) RelatedArtists(ctx context.Context, artistID string) ([]utils.FullArtist, error) {
+	var result struct {
+		Artists []utils.FullArtist `json:"artists"`
+	}
+	if err := c.get(ctx, "/artists/"+artistID+"/related-artists", nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Artists, nil
+}
@@ -0,0 +1,49 @@
+package spotify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/shashankgroovy/morag/utils"
+)
+
+// MaxAudioFeatureIDs is the largest number of ids accepted by AudioFeatures
+const MaxAudioFeatureIDs = 100
+
+// AudioFeatures returns the audio features of up to MaxAudioFeatureIDs tracks
+// in a single request. Tracks without features are left out of the result.
+func (c *Client) AudioFeatures(ctx context.Context, trackIDs []string) ([]utils.AudioFeatures, error) {
+	if len(trackIDs) > MaxAudioFeatureIDs {
+		return nil, fmt.Errorf("spotify: at most %d track ids per request, got %d", MaxAudioFeatureIDs, len(trackIDs))
+	}
+
+	var result struct {
+		AudioFeatures []*utils.AudioFeatures `json:"audio_features"`
+	}
+	q := url.Values{}
+	q.Set("ids", strings.Join(trackIDs, ","))
+	if err := c.get(ctx, "/audio-features", q, &result); err != nil {
+		return nil, err
+	}
+
+	features := make([]utils.AudioFeatures, 0, len(result.AudioFeatures))
+	for _, f := range result.AudioFeatures {
+		if f != nil {
+			features = append(features, *f)
+		}
+	}
+	return features, nil
+}
+
+// AudioAnalysis returns the audio analysis of a track, its bars, beats,
+// sections, segments and tatums, as the raw JSON sent by Spotify
+func (c *Client) AudioAnalysis(ctx context.Context, trackID string) (json.RawMessage, error) {
+	var analysis json.RawMessage
+	if err := c.get(ctx, "/audio-analysis/"+trackID, nil, &analysis); err != nil {
+		return nil, err
+	}
+	return analysis, nil
+}
@@ -0,0 +1,160 @@
+// Package spotify is a small typed client for the parts of the Spotify Web API
+// that morag works with. It can be used on its own, without the morag CLI.
+package spotify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shashankgroovy/morag/utils"
+)
+
+// DefaultBaseURL is the root of the Spotify Web API
+const DefaultBaseURL = "https://api.spotify.com/v1"
+
+// MaxLimit is the largest page size accepted by the paged endpoints
+const MaxLimit = 50
+
+// Client talks to the Spotify Web API on behalf of an authenticated user
+type Client struct {
+	// BaseURL is the root of the API, DefaultBaseURL unless pointed elsewhere
+	BaseURL string
+
+	// HTTPClient is used to send every request
+	HTTPClient *http.Client
+
+	// AccessToken is the OAuth2 bearer token sent with every request
+	AccessToken string
+
+	// Limiter, if set, is waited on before every request and paused
+	// whenever Spotify answers with 429 Too Many Requests. Share one Limiter
+	// between all goroutines using the Client.
+	Limiter *Limiter
+
+	// Retry decides which failed requests are sent again and when
+	Retry utils.RetryPolicy
+
+	// OnRateLimit, if set, is called with the cooldown whenever Spotify
+	// answers with 429 Too Many Requests
+	OnRateLimit func(cooldown time.Duration)
+}
+
+// NewClient returns a Client for the given access token using the default
+// base URL and http.Client
+func NewClient(accessToken string) *Client {
+	return &Client{
+		BaseURL:     DefaultBaseURL,
+		HTTPClient:  &http.Client{},
+		AccessToken: accessToken,
+		Retry:       utils.DefaultRetryPolicy(),
+	}
+}
+
+// AlbumGroups lists the groups an artist's albums fall into
+var AlbumGroups = []string{"album", "single", "compilation", "appears_on"}
+
+// Options holds the optional query parameters of the paged endpoints
+type Options struct {
+	Limit  int
+	Offset int
+
+	// Market is an ISO 3166-1 alpha-2 country code, or "from_token" for the
+	// country of the current user. Only content available there is
+	// returned.
+	Market string
+
+	// IncludeGroups limits ArtistAlbums to albums of the given AlbumGroups
+	IncludeGroups []string
+}
+
+// values converts the options into query parameters
+func (o *Options) values() url.Values {
+	q := url.Values{}
+	if o == nil {
+		return q
+	}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Offset > 0 {
+		q.Set("offset", strconv.Itoa(o.Offset))
+	}
+	if o.Market != "" {
+		q.Set("market", o.Market)
+	}
+	if len(o.IncludeGroups) > 0 {
+		q.Set("include_groups", strings.Join(o.IncludeGroups, ","))
+	}
+	return q
+}
+
+// get sends a GET request for path (relative to BaseURL) and decodes the JSON
+// response into out
+func (c *Client) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	spotifyURL := c.BaseURL + path
+	if len(query) > 0 {
+		spotifyURL += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest("GET", spotifyURL, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Add("Authorization", "Bearer "+c.AccessToken)
+
+	return c.do(req, out)
+}
+
+// do fires a request, retrying it according to c.Retry, and decodes a
+// successful response into out
+func (c *Client) do(req *http.Request, out interface{}) error {
+	ctx := req.Context()
+
+	send := func() (*http.Response, error) {
+		if c.Limiter != nil {
+			if err := c.Limiter.Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+		return c.HTTPClient.Do(req)
+	}
+
+	onRetry := func(attempt int, wait time.Duration, resp *http.Response, err error) {
+		if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+			return
+		}
+		if c.Limiter != nil {
+			// Everybody sharing the limiter cools down together
+			c.Limiter.Pause(wait)
+		}
+		if c.OnRateLimit != nil {
+			c.OnRateLimit(wait)
+		}
+	}
+
+	resp, err := c.Retry.Do(ctx, send, onRetry)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retryAfter, _ := utils.RetryAfter(resp, time.Now())
+		return &RateLimitError{RetryAfter: retryAfter}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return decodeError(resp)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("spotify: could not parse JSON response: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package spotify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Error is the error object returned by the Spotify Web API for any
+// unsuccessful request
+type Error struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("spotify: %d %s", e.Status, e.Message)
+}
+
+// RateLimitError is returned once a request is still being rate limited after
+// every retry has been used up
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("spotify: rate limited, retry after %s", e.RetryAfter)
+}
+
+// decodeError turns an unsuccessful http.Response into an *Error
+func decodeError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	var result struct {
+		Error *Error `json:"error"`
+	}
+	if err := json.Unmarshal(body, &result); err == nil && result.Error != nil {
+		if result.Error.Status == 0 {
+			result.Error.Status = resp.StatusCode
+		}
+		return result.Error
+	}
+
+	return &Error{Status: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+}
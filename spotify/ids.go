@@ -0,0 +1,57 @@
+package spotify
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// idPattern matches a Spotify id, 22 base62 characters
+var idPattern = regexp.MustCompile(`^[0-9A-Za-z]{22}$`)
+
+// IsID reports whether s looks like a Spotify id
+func IsID(s string) bool {
+	return idPattern.MatchString(s)
+}
+
+// ParseID extracts the id of an object of the given kind ("artist", "album",
+// "track", "playlist") from any of the forms Spotify hands out:
+//
+//	0OdUWJ0sBjDrqHygGUXeCF
+//	spotify:artist:0OdUWJ0sBjDrqHygGUXeCF
+//	https://open.spotify.com/artist/0OdUWJ0sBjDrqHygGUXeCF?si=...
+func ParseID(kind, input string) (string, error) {
+	input = strings.TrimSpace(input)
+
+	switch {
+	case IsID(input):
+		return input, nil
+
+	case strings.HasPrefix(input, "spotify:"):
+		// spotify:artist:{id}, older playlist URIs carry the owner as
+		// spotify:user:{user}:playlist:{id}
+		parts := strings.Split(input, ":")
+		if len(parts) >= 3 && parts[len(parts)-2] == kind && IsID(parts[len(parts)-1]) {
+			return parts[len(parts)-1], nil
+		}
+
+	case strings.Contains(input, "open.spotify.com/"):
+		if !strings.Contains(input, "://") {
+			input = "https://" + input
+		}
+		u, err := url.Parse(input)
+		if err != nil {
+			break
+		}
+		// Links may carry a locale such as /intl-de/ in front of the kind
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		for i := 0; i+1 < len(parts); i++ {
+			if parts[i] == kind && IsID(parts[i+1]) {
+				return parts[i+1], nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("spotify: %q is not a valid %s id, URI or link", input, kind)
+}
@@ -0,0 +1,53 @@
+package spotify
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+
+	"github.com/shashankgroovy/morag/utils"
+)
+
+// SavedTracks returns one page of the tracks saved in the library of the
+// current user, most recently saved first. Needs the user-library-read
+// scope.
+func (c *Client) SavedTracks(ctx context.Context, opt *Options) (*utils.SavedTrackPage, error) {
+	var page utils.SavedTrackPage
+	if err := c.get(ctx, "/me/tracks", opt.values(), &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// SavedAlbums returns one page of the albums saved in the library of the
+// current user, most recently saved first. Needs the user-library-read
+// scope.
+func (c *Client) SavedAlbums(ctx context.Context, opt *Options) (*utils.SavedAlbumPage, error) {
+	var page utils.SavedAlbumPage
+	if err := c.get(ctx, "/me/albums", opt.values(), &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// FollowedArtists returns one page of up to limit artists followed by the
+// current user, starting after the artist with the given id or from the
+// first one if after is empty. Needs the user-follow-read scope.
+func (c *Client) FollowedArtists(ctx context.Context, after string, limit int) (*utils.CursorArtistPage, error) {
+	q := url.Values{}
+	q.Set("type", "artist")
+	if after != "" {
+		q.Set("after", after)
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+
+	var result struct {
+		Artists utils.CursorArtistPage `json:"artists"`
+	}
+	if err := c.get(ctx, "/me/following", q, &result); err != nil {
+		return nil, err
+	}
+	return &result.Artists, nil
+}
@@ -0,0 +1,88 @@
+package spotify
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket meant to be shared by every request a Client
+// sends. Besides spacing requests out it lets all callers back off together
+// once Spotify asks for a cooldown.
+type Limiter struct {
+	mu       sync.Mutex
+	rate     float64
+	burst    float64
+	tokens   float64
+	last     time.Time
+	resumeAt time.Time
+}
+
+// NewLimiter returns a Limiter that allows perSecond requests on average with
+// bursts of up to burst requests
+func NewLimiter(perSecond float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:   perSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a request may be sent or ctx is done
+func (l *Limiter) Wait(ctx context.Context) error {
+	for {
+		delay := l.reserve()
+		if delay <= 0 {
+			return nil
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Pause holds back every caller of Wait for d. Overlapping pauses are not
+// added up, the one ending last wins.
+func (l *Limiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if resumeAt := time.Now().Add(d); resumeAt.After(l.resumeAt) {
+		l.resumeAt = resumeAt
+	}
+}
+
+// reserve takes a token if one is available and otherwise returns how long
+// to wait before trying again
+func (l *Limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(l.resumeAt) {
+		return l.resumeAt.Sub(now)
+	}
+
+	// Refill the bucket for the time passed since the last call
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens -= 1
+		return 0
+	}
+	if l.rate <= 0 {
+		return time.Second
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
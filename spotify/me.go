@@ -0,0 +1,17 @@
+package spotify
+
+import (
+	"context"
+
+	"github.com/shashankgroovy/morag/utils"
+)
+
+// Me returns the profile of the current user. The country is only filled in
+// when the token was granted the user-read-private scope.
+func (c *Client) Me(ctx context.Context) (*utils.PrivateUser, error) {
+	var user utils.PrivateUser
+	if err := c.get(ctx, "/me", nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
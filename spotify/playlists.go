@@ -0,0 +1,91 @@
+package spotify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/shashankgroovy/morag/utils"
+)
+
+// MaxPlaylistLimit is the largest page size accepted by PlaylistItems
+const MaxPlaylistLimit = 100
+
+// Playlist describes a playlist
+func (c *Client) Playlist(ctx context.Context, playlistID string) (*utils.Playlist, error) {
+	var playlist utils.Playlist
+	if err := c.get(ctx, "/playlists/"+playlistID, nil, &playlist); err != nil {
+		return nil, err
+	}
+	return &playlist, nil
+}
+
+// PlaylistItems returns one page of a playlist's items, tracks as well as
+// podcast episodes. With opt.Market set tracks are relinked as described for
+// Tracks.
+func (c *Client) PlaylistItems(ctx context.Context, playlistID string, opt *Options) (*utils.PlaylistItemPage, error) {
+	var raw struct {
+		utils.Paging
+		Items []struct {
+			AddedAt string           `json:"added_at"`
+			AddedBy utils.PublicUser `json:"added_by"`
+			IsLocal bool             `json:"is_local"`
+			Track   json.RawMessage  `json:"track"`
+		} `json:"items"`
+	}
+	q := opt.values()
+	q.Set("additional_types", "track,episode")
+	path := fmt.Sprintf("/playlists/%s/tracks", playlistID)
+	if err := c.get(ctx, path, q, &raw); err != nil {
+		return nil, err
+	}
+
+	page := &utils.PlaylistItemPage{Paging: raw.Paging}
+	for _, item := range raw.Items {
+		page.Items = append(page.Items, utils.PlaylistItem{
+			AddedAt: item.AddedAt,
+			AddedBy: item.AddedBy,
+			IsLocal: item.IsLocal,
+			Track:   decodeItem(item.Track),
+		})
+	}
+	return page, nil
+}
+
+// decodeItem decodes the track or episode of a playlist item. Whatever does
+// not fit a track, such as an episode of an odd shape, is decoded as far as
+// the fields every item has, so that one entry can't break the whole page.
+func decodeItem(data json.RawMessage) *utils.FullSoundtrack {
+	if len(data) == 0 || string(data) == "null" {
+		return nil
+	}
+
+	var track utils.FullSoundtrack
+	if err := json.Unmarshal(data, &track); err == nil {
+		return &track
+	}
+
+	var item struct {
+		DurationMs   int               `json:"duration_ms"`
+		Explicit     bool              `json:"explicit"`
+		ExternalUrls utils.ExternalUrl `json:"external_urls"`
+		Href         string            `json:"href"`
+		Id           string            `json:"id"`
+		Name         string            `json:"name"`
+		Type         string            `json:"type"`
+		Uri          string            `json:"uri"`
+	}
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil
+	}
+	return &utils.FullSoundtrack{
+		DurationMs:   item.DurationMs,
+		Explicit:     item.Explicit,
+		ExternalUrls: item.ExternalUrls,
+		Href:         item.Href,
+		Id:           item.Id,
+		Name:         item.Name,
+		Type:         item.Type,
+		Uri:          item.Uri,
+	}
+}
@@ -0,0 +1,49 @@
+package spotify
+
+import (
+	"context"
+	"strings"
+
+	"github.com/shashankgroovy/morag/utils"
+)
+
+// SearchTypes lists the kinds of objects Search looks for
+var SearchTypes = []string{"track", "album", "artist", "playlist"}
+
+// MaxSearchOffset caps the offset plus limit of a Search, results past it
+// can't be paged to
+const MaxSearchOffset = 1000
+
+// SearchResult holds a page of results for every type searched for
+type SearchResult struct {
+	Albums    *utils.AlbumPage          `json:"albums,omitempty"`
+	Artists   *utils.ArtistPage         `json:"artists,omitempty"`
+	Playlists *utils.PlaylistPage       `json:"playlists,omitempty"`
+	Tracks    *utils.FullSoundtrackPage `json:"tracks,omitempty"`
+}
+
+// Search looks up the catalog for query. types lists the kinds of objects to
+// search for, e.g. "artist". The query may hold field filters such as
+// artist:, album:, year:, genre:, isrc: and upc:.
+func (c *Client) Search(ctx context.Context, query string, types []string, opt *Options) (*SearchResult, error) {
+	var result SearchResult
+
+	q := opt.values()
+	q.Set("q", query)
+	q.Set("type", strings.Join(types, ","))
+	if err := c.get(ctx, "/search", q, &result); err != nil {
+		return nil, err
+	}
+
+	// Playlists Spotify can't show any more are listed as null
+	if result.Playlists != nil {
+		var playlists []utils.Playlist
+		for _, playlist := range result.Playlists.Items {
+			if playlist.Id != "" {
+				playlists = append(playlists, playlist)
+			}
+		}
+		result.Playlists.Items = playlists
+	}
+	return &result, nil
+}
@@ -0,0 +1,62 @@
+package spotify
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/shashankgroovy/morag/utils"
+)
+
+// MaxTrackIDs is the largest number of ids accepted by Tracks
+const MaxTrackIDs = 50
+
+// Track returns the full track object of a single track. With a market the
+// track may be relinked, see Tracks.
+func (c *Client) Track(ctx context.Context, trackID, market string) (*utils.FullSoundtrack, error) {
+	var track utils.FullSoundtrack
+	if err := c.get(ctx, "/tracks/"+trackID, marketQuery(market), &track); err != nil {
+		return nil, err
+	}
+	return &track, nil
+}
+
+// Tracks returns the full track objects of up to MaxTrackIDs tracks in a
+// single request. Ids unknown to Spotify are left out of the result.
+//
+// Given a market, an ISO 3166-1 alpha-2 country code or "from_token",
+// tracks carry is_playable and restrictions for that market, and tracks not
+// available there may be relinked: Spotify answers with another copy of the
+// recording that is, and the track asked for is in LinkedFrom.
+func (c *Client) Tracks(ctx context.Context, trackIDs []string, market string) ([]utils.FullSoundtrack, error) {
+	if len(trackIDs) > MaxTrackIDs {
+		return nil, fmt.Errorf("spotify: at most %d track ids per request, got %d", MaxTrackIDs, len(trackIDs))
+	}
+
+	var result struct {
+		Tracks []*utils.FullSoundtrack `json:"tracks"`
+	}
+	q := marketQuery(market)
+	q.Set("ids", strings.Join(trackIDs, ","))
+	if err := c.get(ctx, "/tracks", q, &result); err != nil {
+		return nil, err
+	}
+
+	tracks := make([]utils.FullSoundtrack, 0, len(result.Tracks))
+	for _, track := range result.Tracks {
+		if track != nil {
+			tracks = append(tracks, *track)
+		}
+	}
+	return tracks, nil
+}
+
+// marketQuery returns the query parameters asking for content of a market
+func marketQuery(market string) url.Values {
+	q := url.Values{}
+	if market != "" {
+		q.Set("market", market)
+	}
+	return q
+}
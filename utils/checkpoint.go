@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// Checkpoint is an append-only journal of the work a fetch has completed. Each
+// line records, for one of the artists being fetched, either an album whose
+// tracks have all been listed, along with their ids, or a track whose row has
+// been written to the output.
+type Checkpoint struct {
+	mu     sync.Mutex
+	file   *os.File
+	albums map[string][]string
+	tracks map[string]bool
+}
+
+// checkpointEntry is a single line of the journal
+type checkpointEntry struct {
+	Artist string   `json:"artist"`
+	Album  string   `json:"album,omitempty"`
+	Tracks []string `json:"tracks,omitempty"`
+	Track  string   `json:"track,omitempty"`
+}
+
+// OpenCheckpoint opens the journal at path. When resuming, the entries already
+// in the journal are loaded and new ones are appended, otherwise the journal
+// is started afresh.
+func OpenCheckpoint(path string, resume bool) (*Checkpoint, error) {
+	c := &Checkpoint{
+		albums: make(map[string][]string),
+		tracks: make(map[string]bool),
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		if err := c.load(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	c.file = file
+
+	return c, nil
+}
+
+// load reads back the entries of an existing journal
+func (c *Checkpoint) load(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry checkpointEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// The last line may have been cut short when the previous run
+			// died, whatever it recorded simply gets fetched again
+			continue
+		}
+		if entry.Album != "" {
+			c.albums[checkpointKey(entry.Artist, entry.Album)] = entry.Tracks
+		}
+		if entry.Track != "" {
+			c.tracks[checkpointKey(entry.Artist, entry.Track)] = true
+		}
+	}
+	return scanner.Err()
+}
+
+// Tracks returns the number of tracks recorded as done across all artists
+func (c *Checkpoint) Tracks() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.tracks)
+}
+
+// Artist returns the part of the checkpoint that belongs to an artist
+func (c *Checkpoint) Artist(artistID string) *ArtistCheckpoint {
+	return &ArtistCheckpoint{c: c, artistID: artistID}
+}
+
+// ArtistCheckpoint reads and records the completed work of a single artist
+type ArtistCheckpoint struct {
+	c        *Checkpoint
+	artistID string
+}
+
+// Album returns the track ids recorded for an album, and whether the album
+// has been listed at all
+func (a *ArtistCheckpoint) Album(albumID string) ([]string, bool) {
+	a.c.mu.Lock()
+	defer a.c.mu.Unlock()
+
+	trackIDs, ok := a.c.albums[checkpointKey(a.artistID, albumID)]
+	return trackIDs, ok
+}
+
+// TrackDone reports whether a track's row has already been written
+func (a *ArtistCheckpoint) TrackDone(trackID string) bool {
+	a.c.mu.Lock()
+	defer a.c.mu.Unlock()
+
+	return a.c.tracks[checkpointKey(a.artistID, trackID)]
+}
+
+// RecordAlbum records that every track of an album has been listed
+func (a *ArtistCheckpoint) RecordAlbum(albumID string, trackIDs []string) error {
+	a.c.mu.Lock()
+	defer a.c.mu.Unlock()
+
+	a.c.albums[checkpointKey(a.artistID, albumID)] = trackIDs
+	return a.c.write(checkpointEntry{Artist: a.artistID, Album: albumID, Tracks: trackIDs})
+}
+
+// RecordTracks records that the rows of the given tracks have been written
+func (a *ArtistCheckpoint) RecordTracks(trackIDs []string) error {
+	a.c.mu.Lock()
+	defer a.c.mu.Unlock()
+
+	var entries []checkpointEntry
+	for _, id := range trackIDs {
+		key := checkpointKey(a.artistID, id)
+		if !a.c.tracks[key] {
+			a.c.tracks[key] = true
+			entries = append(entries, checkpointEntry{Artist: a.artistID, Track: id})
+		}
+	}
+	if err := a.c.write(entries...); err != nil {
+		return err
+	}
+	return a.c.file.Sync()
+}
+
+// checkpointKey scopes an album or track id to an artist, as the same
+// release can show up in the catalogs of several artists
+func checkpointKey(artistID, id string) string {
+	return artistID + "/" + id
+}
+
+// write appends entries to the journal, one per line
+func (c *Checkpoint) write(entries ...checkpointEntry) error {
+	var lines []byte
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+	_, err := c.file.Write(lines)
+	return err
+}
+
+// Close closes the journal file
+func (c *Checkpoint) Close() error {
+	return c.file.Close()
+}
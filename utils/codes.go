@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Kinds of codes identifying releases outside of Spotify
+const (
+	// CodeISRC is the International Standard Recording Code of a track
+	CodeISRC = "isrc"
+	// CodeUPC is the Universal Product Code, or EAN, of an album
+	CodeUPC = "upc"
+)
+
+// isrcPattern matches a normalized ISRC: country, registrant, year and
+// designation code
+var isrcPattern = regexp.MustCompile(`^[A-Z]{2}[A-Z0-9]{3}[0-9]{7}$`)
+
+// upcPattern matches a normalized UPC, EAN or GTIN
+var upcPattern = regexp.MustCompile(`^[0-9]{8,14}$`)
+
+// NormalizeCode strips the spaces, dashes and dots codes are often written
+// with and upper-cases them
+func NormalizeCode(code string) string {
+	code = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '-', '.':
+			return -1
+		}
+		return r
+	}, code)
+	return strings.ToUpper(code)
+}
+
+// ValidCode reports whether a normalized code is a well-formed code of the
+// given kind
+func ValidCode(kind, code string) bool {
+	switch kind {
+	case CodeISRC:
+		return isrcPattern.MatchString(code)
+	case CodeUPC:
+		return upcPattern.MatchString(code)
+	}
+	return false
+}
+
+// Has reports whether the ids carry the given code. UPCs and EANs are
+// compared regardless of the zeros they are padded with.
+func (e ExternalId) Has(kind, code string) bool {
+	code = NormalizeCode(code)
+	switch kind {
+	case CodeISRC:
+		return code != "" && NormalizeCode(e.Isrc) == code
+	case CodeUPC:
+		code = strings.TrimLeft(code, "0")
+		if code == "" {
+			return false
+		}
+		return strings.TrimLeft(NormalizeCode(e.Upc), "0") == code ||
+			strings.TrimLeft(NormalizeCode(e.Ean), "0") == code
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Strategies for telling that two rows hold the same recording
+const (
+	// DedupByID merges rows of the same track id
+	DedupByID = "id"
+	// DedupByISRC merges rows carrying the same ISRC, the code identifying
+	// a recording across releases. Rows without one are merged by id.
+	DedupByISRC = "isrc"
+	// DedupByTitle merges rows by the same lead artist whose titles match
+	// once edition markers are stripped and whose durations are close
+	DedupByTitle = "title"
+)
+
+// DedupStrategies lists the ways rows can be deduplicated
+var DedupStrategies = []string{DedupByID, DedupByISRC, DedupByTitle}
+
+// durationTolerance is how far apart, in milliseconds, the durations of two
+// rows with the same title may be to still count as one recording
+const durationTolerance = 2000
+
+// editionKeywords are the words telling an edition of a recording apart
+// rather than another recording, such as a live take or a remix
+const editionKeywords = `\b(remaster\w*|deluxe|edition|mono|stereo)\b`
+
+// ratingTag is a content rating, which only marks an edition when it is
+// the whole tag, as "Clean" is also part of names such as "Clean Bandit"
+const ratingTag = `\s*(clean|explicit)\s*`
+
+// editionMarker matches the bracketed parts and the last dashed part of a
+// title naming an edition, e.g. "(Remastered 2011)", "[Explicit]" or
+// "- Deluxe Edition". Those naming anything else, e.g. "(Live at Wembley)"
+// or "[Remix]", are kept.
+var editionMarker = regexp.MustCompile(`(?i)\s*(` +
+	`\(` + ratingTag + `\)|\[` + ratingTag + `\]|` +
+	`\([^)]*` + editionKeywords + `[^)]*\)|\[[^\]]*` + editionKeywords + `[^\]]*\]|` +
+	`\s-\s[^-]*` + editionKeywords + `[^-]*$)`)
+
+// Dedup merges the rows holding the same recording into a canonical row per
+// recording. The canonical row is the one from the earliest release, then
+// the most popular one, then the first one seen. The ids of the other rows
+// end up in its AlternateIds. Rows keep the order in which their recording
+// was first seen.
+func Dedup(rows []CatalogRow, strategy string) ([]CatalogRow, error) {
+	var key func(CatalogRow) string
+	switch strategy {
+	case DedupByID:
+		key = func(row CatalogRow) string { return row.Id }
+	case DedupByISRC:
+		key = func(row CatalogRow) string {
+			if isrc := strings.ToUpper(strings.TrimSpace(row.ExternalIds.Isrc)); isrc != "" {
+				return "isrc:" + isrc
+			}
+			return "id:" + row.Id
+		}
+	case DedupByTitle:
+		key = titleKey
+	default:
+		return nil, fmt.Errorf("unknown dedup strategy %q, use one of %s", strategy, strings.Join(DedupStrategies, ", "))
+	}
+
+	// Every key holds one or more groups, more only when titles match but
+	// durations are too far apart
+	var groups [][]CatalogRow
+	byKey := make(map[string][]int)
+	for _, row := range rows {
+		k := key(row)
+		if row.Id == "" || k == "" {
+			// Local files have nothing to compare
+			groups = append(groups, []CatalogRow{row})
+			continue
+		}
+
+		found := -1
+		for _, g := range byKey[k] {
+			if strategy != DedupByTitle || closeDuration(groups[g][0], row) {
+				found = g
+				break
+			}
+		}
+		if found < 0 {
+			byKey[k] = append(byKey[k], len(groups))
+			groups = append(groups, []CatalogRow{row})
+			continue
+		}
+		groups[found] = append(groups[found], row)
+	}
+
+	deduped := make([]CatalogRow, 0, len(groups))
+	for _, group := range groups {
+		deduped = append(deduped, canonical(group))
+	}
+	return deduped, nil
+}
+
+// canonical picks the row standing in for a group of rows and lists the
+// ids of the others on it
+func canonical(group []CatalogRow) CatalogRow {
+	best := 0
+	for i := 1; i < len(group); i++ {
+		if preferred(group[i], group[best]) {
+			best = i
+		}
+	}
+
+	row := group[best]
+	seen := map[string]bool{row.Id: true}
+	var alternates []string
+	for _, other := range group {
+		ids := append([]string{other.Id}, other.AlternateIds...)
+		for _, id := range ids {
+			if id != "" && !seen[id] {
+				seen[id] = true
+				alternates = append(alternates, id)
+			}
+		}
+	}
+	row.AlternateIds = alternates
+	return row
+}
+
+// preferred reports whether a makes a better canonical row than b
+func preferred(a, b CatalogRow) bool {
+	aDate, bDate := a.Album.ReleaseDate, b.Album.ReleaseDate
+	if aDate != "" && bDate != "" && aDate != bDate {
+		// Dates are YYYY, YYYY-MM or YYYY-MM-DD, compare what both have
+		n := len(aDate)
+		if len(bDate) < n {
+			n = len(bDate)
+		}
+		if aDate[:n] != bDate[:n] {
+			return aDate[:n] < bDate[:n]
+		}
+	}
+	if (aDate == "") != (bDate == "") {
+		// A known release date beats an unknown one
+		return aDate != ""
+	}
+	return a.Popularity > b.Popularity
+}
+
+// titleKey identifies a recording by its lead artist and normalized title
+func titleKey(row CatalogRow) string {
+	title := NormalizeTitle(row.Name)
+	if title == "" {
+		return ""
+	}
+	artist := ""
+	if len(row.Artists) > 0 {
+		artist = row.Artists[0].Id
+		if artist == "" {
+			artist = strings.ToLower(row.Artists[0].Name)
+		}
+	}
+	return artist + "\x00" + title
+}
+
+// NormalizeTitle strips a title of case, extra spacing and the markers of
+// re-issues and editions
+func NormalizeTitle(title string) string {
+	title = editionMarker.ReplaceAllString(title, "")
+	return strings.Join(strings.Fields(strings.ToLower(title)), " ")
+}
+
+// closeDuration reports whether two rows last about as long
+func closeDuration(a, b CatalogRow) bool {
+	d := a.DurationMs - b.DurationMs
+	return d >= -durationTolerance && d <= durationTolerance
+}
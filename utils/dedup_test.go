@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Song", "song"},
+		{"  Song   Title ", "song title"},
+		{"Song (Remastered 2011)", "song"},
+		{"Song - 2011 Remaster", "song"},
+		{"Song - Remastered", "song"},
+		{"Song (Deluxe Edition)", "song"},
+		{"Song [Explicit]", "song"},
+		{"Song (Clean)", "song"},
+		{"Song - Mono", "song"},
+		{"Song (Stereo Mix) - Remastered 2009", "song"},
+		{"Song (Live at Wembley)", "song (live at wembley)"},
+		{"Song (Live at Wembley) - Remastered", "song (live at wembley)"},
+		{"Song (feat. X)", "song (feat. x)"},
+		{"Song [Remix]", "song [remix]"},
+		{"Song (Acoustic)", "song (acoustic)"},
+		{"Song - Live", "song - live"},
+		{"(I Can't Get No) Satisfaction", "(i can't get no) satisfaction"},
+		{"Monotone", "monotone"},
+		{"Cleaner (Edit)", "cleaner (edit)"},
+		{"Rather Be (feat. Jess Glynne) [Clean Bandit Remix]", "rather be (feat. jess glynne) [clean bandit remix]"},
+		{"Song (Explicit Content Warning)", "song (explicit content warning)"},
+		{"Song - Remix - 2011 Remaster", "song - remix"},
+		{"Song - Live - Remastered", "song - live"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeTitle(tt.title); got != tt.want {
+			t.Errorf("NormalizeTitle(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+// track builds a catalog row with just what Dedup looks at
+func track(id, isrc, name string, durationMs int, releaseDate string, popularity int) CatalogRow {
+	var row CatalogRow
+	row.Id = id
+	row.ExternalIds.Isrc = isrc
+	row.Name = name
+	row.Artists = []SimplifiedArtist{{Id: "artist"}}
+	row.DurationMs = durationMs
+	row.Album.ReleaseDate = releaseDate
+	row.Popularity = popularity
+	return row
+}
+
+func TestDedup(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		rows     []CatalogRow
+		// want lists the id of every row kept, followed by its alternate ids
+		want [][]string
+	}{
+		{
+			name:     "isrc merges the same code",
+			strategy: DedupByISRC,
+			rows: []CatalogRow{
+				track("a", "USABC1100001", "Song", 200000, "2011", 10),
+				track("b", "usabc1100001 ", "Song", 200000, "2011", 20),
+			},
+			want: [][]string{{"b", "a"}},
+		},
+		{
+			name:     "isrc falls back to the id without a code",
+			strategy: DedupByISRC,
+			rows: []CatalogRow{
+				track("a", "", "Song", 200000, "2011", 10),
+				track("b", "", "Song", 200000, "2011", 10),
+				track("a", "", "Song", 200000, "2011", 10),
+			},
+			want: [][]string{{"a"}, {"b"}},
+		},
+		{
+			name:     "title merges durations at the tolerance",
+			strategy: DedupByTitle,
+			rows: []CatalogRow{
+				track("a", "", "Song", 200000, "2011", 0),
+				track("b", "", "Song - Remastered", 200000+durationTolerance, "2011", 0),
+			},
+			want: [][]string{{"a", "b"}},
+		},
+		{
+			name:     "title keeps durations past the tolerance apart",
+			strategy: DedupByTitle,
+			rows: []CatalogRow{
+				track("a", "", "Song", 200000, "2011", 0),
+				track("b", "", "Song - Remastered", 200000+durationTolerance+1, "2011", 0),
+			},
+			want: [][]string{{"a"}, {"b"}},
+		},
+		{
+			name:     "the earliest release is canonical",
+			strategy: DedupByID,
+			rows: []CatalogRow{
+				track("a", "", "Song", 200000, "2011-05-02", 90),
+				track("a", "", "Song", 200000, "1969", 10),
+				track("a", "", "Song", 200000, "", 100),
+			},
+			want: [][]string{{"a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		rows, err := Dedup(tt.rows, tt.strategy)
+		if err != nil {
+			t.Fatalf("%s: Dedup() error = %v", tt.name, err)
+		}
+		var got [][]string
+		for _, row := range rows {
+			got = append(got, append([]string{row.Id}, row.AlternateIds...))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Dedup() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	group := []CatalogRow{
+		track("remaster", "", "Song - 2011 Remaster", 200000, "2011-05-02", 90),
+		track("original", "", "Song", 200000, "1969", 10),
+		track("reissue", "", "Song", 200000, "1969-09-26", 50),
+		track("unknown", "", "Song", 200000, "", 100),
+	}
+	row := canonical(group)
+	if row.Id != "reissue" {
+		t.Errorf("canonical() picked %q, want %q", row.Id, "reissue")
+	}
+	if want := []string{"remaster", "original", "unknown"}; !reflect.DeepEqual(row.AlternateIds, want) {
+		t.Errorf("canonical() alternates = %v, want %v", row.AlternateIds, want)
+	}
+}
+
+func TestPreferred(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b CatalogRow
+		want bool
+	}{
+		{"earlier year", track("a", "", "", 0, "1969", 0), track("b", "", "", 0, "2011", 0), true},
+		{"later year", track("a", "", "", 0, "2011", 0), track("b", "", "", 0, "1969", 0), false},
+		{"earlier day", track("a", "", "", 0, "1969-09-01", 0), track("b", "", "", 0, "1969-09-26", 0), true},
+		{"same year, more precise", track("a", "", "", 0, "1969-09-26", 0), track("b", "", "", 0, "1969", 50), false},
+		{"same year, more popular", track("a", "", "", 0, "1969-09-26", 60), track("b", "", "", 0, "1969", 50), true},
+		{"a date beats none", track("a", "", "", 0, "2011", 0), track("b", "", "", 0, "", 90), true},
+		{"no date loses", track("a", "", "", 0, "", 90), track("b", "", "", 0, "2011", 0), false},
+		{"more popular", track("a", "", "", 0, "", 60), track("b", "", "", 0, "", 50), true},
+		{"ties keep the first", track("a", "", "", 0, "2011", 50), track("b", "", "", 0, "2011", 50), false},
+	}
+
+	for _, tt := range tests {
+		if got := preferred(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: preferred() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Clock tells the time and waits. RetryPolicy goes through a Clock so that
+// tests can swap in a fake one.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the Clock backed by the time package
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// RetryPolicy decides if and when a failed http request is sent again. It
+// retries 429 Too Many Requests, 500, 502, 503 and 504 responses as well as
+// connection resets and timeouts.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, the first one included
+	MaxAttempts int
+
+	// BaseDelay is the wait before the first retry, doubled for every retry
+	// after that
+	BaseDelay time.Duration
+
+	// MaxDelay caps a single wait, unless Spotify asks for more with
+	// Retry-After
+	MaxDelay time.Duration
+
+	// MaxElapsed stops retrying once this much time has passed since the
+	// first attempt. Zero means no limit.
+	MaxElapsed time.Duration
+
+	// Jitter spreads waits randomly by up to this fraction of their length
+	// so that workers don't retry in lockstep
+	Jitter float64
+
+	// Clock defaults to the real clock
+	Clock Clock
+
+	// Random returns a number in [0, 1) and defaults to rand.Float64
+	Random func() float64
+}
+
+// DefaultRetryPolicy returns the retry policy used by morag
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 6,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    30 * time.Second,
+		MaxElapsed:  5 * time.Minute,
+		Jitter:      0.2,
+	}
+}
+
+// Do calls send until it succeeds, fails with an error that isn't worth
+// retrying, or the policy gives up. When it gives up on a retryable response,
+// that last response is returned with its body still open.
+//
+// onRetry, if not nil, is called before every wait with the attempt that just
+// failed and the time about to be spent waiting.
+func (p RetryPolicy) Do(ctx context.Context, send func() (*http.Response, error), onRetry func(attempt int, wait time.Duration, resp *http.Response, err error)) (*http.Response, error) {
+	clock := p.clock()
+	start := clock.Now()
+
+	for attempt := 1; ; attempt++ {
+		resp, err := send()
+		if !Retryable(resp, err) || ctx.Err() != nil {
+			return resp, err
+		}
+		if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+			return resp, err
+		}
+
+		wait := p.Delay(attempt, resp)
+
+		// Don't start a wait that ends past the time we're allowed to spend
+		now := clock.Now()
+		if p.MaxElapsed > 0 && now.Add(wait).Sub(start) > p.MaxElapsed {
+			return resp, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && now.Add(wait).After(deadline) {
+			return resp, err
+		}
+
+		if onRetry != nil {
+			onRetry(attempt, wait, resp, err)
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		select {
+		case <-clock.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Delay returns how long to wait after the given failed attempt (counting
+// from 1). A Retry-After header on resp is always honoured in full, jitter is
+// only ever added on top of it.
+func (p RetryPolicy) Delay(attempt int, resp *http.Response) time.Duration {
+	random := p.Random
+	if random == nil {
+		random = rand.Float64
+	}
+
+	if retryAfter, ok := RetryAfter(resp, p.clock().Now()); ok {
+		return retryAfter + time.Duration(p.Jitter*random()*float64(p.BaseDelay))
+	}
+
+	backoff := float64(p.BaseDelay) * math.Pow(2, float64(attempt-1))
+	if p.MaxDelay > 0 && backoff > float64(p.MaxDelay) {
+		backoff = float64(p.MaxDelay)
+	}
+	// Spread the wait evenly over [backoff*(1-Jitter), backoff*(1+Jitter))
+	backoff *= 1 + p.Jitter*(2*random()-1)
+
+	return time.Duration(backoff)
+}
+
+func (p RetryPolicy) clock() Clock {
+	if p.Clock == nil {
+		return realClock{}
+	}
+	return p.Clock
+}
+
+// RetryAfter reads the Retry-After header of resp, given either in seconds or
+// as an HTTP date
+func RetryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := date.Sub(now); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// Retryable reports whether the outcome of an http request is worth trying
+// again
+func Retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return isTransientNetError(err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isTransientNetError digs through the errors returned by http.Client for a
+// connection reset, an unexpected EOF or a timeout
+func isTransientNetError(err error) bool {
+	for err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF || err == syscall.ECONNRESET || err == syscall.ECONNABORTED || err == syscall.EPIPE {
+			return true
+		}
+
+		switch e := err.(type) {
+		case *url.Error:
+			err = e.Err
+		case *net.OpError:
+			if e.Timeout() {
+				return true
+			}
+			err = e.Err
+		case *os.SyscallError:
+			err = e.Err
+		case net.Error:
+			return e.Timeout()
+		default:
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,282 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeClock only moves forward when something waits on it
+type fakeClock struct {
+	now   time.Time
+	waits []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.waits = append(c.waits, d)
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func response(status int, retryAfter string) *http.Response {
+	resp := &http.Response{
+		StatusCode: status,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}
+	if retryAfter != "" {
+		resp.Header.Set("Retry-After", retryAfter)
+	}
+	return resp
+}
+
+// connReset is the error http.Client returns when the connection is reset
+func connReset() error {
+	return &url.Error{Op: "Get", URL: "https://api.spotify.com/v1/artists", Err: &net.OpError{
+		Op:  "read",
+		Net: "tcp",
+		Err: os.NewSyscallError("read", syscall.ECONNRESET),
+	}}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2019, 8, 20, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		resp   *http.Response
+		want   time.Duration
+		wantOk bool
+	}{
+		{"no response", nil, 0, false},
+		{"no header", response(429, ""), 0, false},
+		{"seconds", response(429, "7"), 7 * time.Second, true},
+		{"zero seconds", response(429, "0"), 0, true},
+		{"http date", response(503, now.Add(90*time.Second).Format(http.TimeFormat)), 90 * time.Second, true},
+		{"http date in the past", response(503, now.Add(-time.Minute).Format(http.TimeFormat)), 0, true},
+		{"negative seconds", response(429, "-3"), 0, false},
+		{"garbage", response(429, "soon"), 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := RetryAfter(tt.resp, now)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("%s: RetryAfter() = %s, %v, want %s, %v", tt.name, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		resp *http.Response
+		err  error
+		want bool
+	}{
+		{"200", response(200, ""), nil, false},
+		{"400", response(400, ""), nil, false},
+		{"401", response(401, ""), nil, false},
+		{"403", response(403, ""), nil, false},
+		{"404", response(404, ""), nil, false},
+		{"429", response(429, ""), nil, true},
+		{"500", response(500, ""), nil, true},
+		{"501", response(501, ""), nil, false},
+		{"502", response(502, ""), nil, true},
+		{"503", response(503, ""), nil, true},
+		{"504", response(504, ""), nil, true},
+		{"connection reset", nil, connReset(), true},
+		{"unexpected EOF", nil, &url.Error{Op: "Get", Err: io.ErrUnexpectedEOF}, true},
+		{"other network error", nil, &url.Error{Op: "Get", Err: errors.New("no such host")}, false},
+	}
+
+	for _, tt := range tests {
+		if got := Retryable(tt.resp, tt.err); got != tt.want {
+			t.Errorf("%s: Retryable() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDelayJitter(t *testing.T) {
+	policy := RetryPolicy{
+		BaseDelay: time.Second,
+		MaxDelay:  10 * time.Second,
+		Jitter:    0.2,
+		Clock:     &fakeClock{now: time.Now()},
+		Random:    rand.New(rand.NewSource(1)).Float64,
+	}
+
+	tests := []struct {
+		attempt  int
+		resp     *http.Response
+		min, max time.Duration
+	}{
+		{1, nil, 800 * time.Millisecond, 1200 * time.Millisecond},
+		{2, nil, 1600 * time.Millisecond, 2400 * time.Millisecond},
+		{3, response(500, ""), 3200 * time.Millisecond, 4800 * time.Millisecond},
+		{5, nil, 8 * time.Second, 12 * time.Second},
+		{10, nil, 8 * time.Second, 12 * time.Second},
+		// Retry-After is never shortened, jitter only adds to it
+		{1, response(429, "30"), 30 * time.Second, 30*time.Second + 200*time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 1000; i++ {
+			got := policy.Delay(tt.attempt, tt.resp)
+			if got < tt.min || got >= tt.max {
+				t.Errorf("Delay(%d) = %s, want within [%s, %s)", tt.attempt, got, tt.min, tt.max)
+				break
+			}
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+	type outcome struct {
+		resp *http.Response
+		err  error
+	}
+	ok := outcome{resp: response(200, "")}
+
+	tests := []struct {
+		name string
+
+		// outcomes are returned by send in order, the last one over and over
+		outcomes []outcome
+		policy   RetryPolicy
+		deadline time.Duration
+
+		wantAttempts int
+		wantStatus   int
+		wantErr      bool
+		wantWaits    []time.Duration
+	}{
+		{
+			name:         "retries 429 and 5xx until it succeeds",
+			outcomes:     []outcome{{resp: response(429, "")}, {resp: response(500, "")}, {resp: response(502, "")}, {resp: response(503, "")}, {resp: response(504, "")}, ok},
+			policy:       RetryPolicy{BaseDelay: time.Second, MaxDelay: 4 * time.Second},
+			wantAttempts: 6,
+			wantStatus:   200,
+			wantWaits:    []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second, 4 * time.Second},
+		},
+		{
+			name:         "does not retry other 4xx",
+			outcomes:     []outcome{{resp: response(404, "")}, ok},
+			policy:       RetryPolicy{BaseDelay: time.Second},
+			wantAttempts: 1,
+			wantStatus:   404,
+		},
+		{
+			name:         "retries connection resets without a response",
+			outcomes:     []outcome{{err: connReset()}, {err: connReset()}, ok},
+			policy:       RetryPolicy{BaseDelay: time.Second},
+			wantAttempts: 3,
+			wantStatus:   200,
+			wantWaits:    []time.Duration{time.Second, 2 * time.Second},
+		},
+		{
+			name:         "gives up on connection resets after MaxAttempts",
+			outcomes:     []outcome{{err: connReset()}},
+			policy:       RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second},
+			wantAttempts: 3,
+			wantErr:      true,
+			wantWaits:    []time.Duration{time.Second, 2 * time.Second},
+		},
+		{
+			name:         "honours Retry-After in seconds",
+			outcomes:     []outcome{{resp: response(429, "12")}, ok},
+			policy:       RetryPolicy{BaseDelay: time.Second, MaxDelay: 2 * time.Second},
+			wantAttempts: 2,
+			wantStatus:   200,
+			wantWaits:    []time.Duration{12 * time.Second},
+		},
+		{
+			name:         "gives up when Retry-After is past MaxElapsed",
+			outcomes:     []outcome{{resp: response(429, "600")}, ok},
+			policy:       RetryPolicy{BaseDelay: time.Second, MaxElapsed: 5 * time.Minute},
+			wantAttempts: 1,
+			wantStatus:   429,
+		},
+		{
+			name:         "stops at MaxElapsed",
+			outcomes:     []outcome{{resp: response(503, "")}},
+			policy:       RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Second, MaxElapsed: 3500 * time.Millisecond},
+			wantAttempts: 4,
+			wantStatus:   503,
+			wantWaits:    []time.Duration{time.Second, time.Second, time.Second},
+		},
+		{
+			name:         "stops at the context deadline",
+			outcomes:     []outcome{{resp: response(500, "")}},
+			policy:       RetryPolicy{BaseDelay: time.Minute, MaxDelay: time.Minute},
+			deadline:     150 * time.Second,
+			wantAttempts: 3,
+			wantStatus:   500,
+			wantWaits:    []time.Duration{time.Minute, time.Minute},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Now()}
+			tt.policy.Clock = clock
+			tt.policy.Random = rand.New(rand.NewSource(1)).Float64
+
+			ctx := context.Background()
+			if tt.deadline > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithDeadline(ctx, clock.now.Add(tt.deadline))
+				defer cancel()
+			}
+
+			attempts := 0
+			send := func() (*http.Response, error) {
+				o := tt.outcomes[len(tt.outcomes)-1]
+				if attempts < len(tt.outcomes) {
+					o = tt.outcomes[attempts]
+				}
+				attempts++
+				return o.resp, o.err
+			}
+			retries := 0
+			onRetry := func(attempt int, wait time.Duration, resp *http.Response, err error) { retries++ }
+
+			resp, err := tt.policy.Do(ctx, send, onRetry)
+
+			if attempts != tt.wantAttempts {
+				t.Errorf("sent %d times, want %d", attempts, tt.wantAttempts)
+			}
+			if retries != attempts-1 {
+				t.Errorf("onRetry called %d times for %d attempts", retries, attempts)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want an error: %v", err, tt.wantErr)
+			}
+			if tt.wantStatus != 0 && (resp == nil || resp.StatusCode != tt.wantStatus) {
+				t.Errorf("resp = %v, want status %d", resp, tt.wantStatus)
+			}
+			if len(clock.waits) != len(tt.wantWaits) {
+				t.Fatalf("waited %v, want %v", clock.waits, tt.wantWaits)
+			}
+			for i, wait := range clock.waits {
+				if wait != tt.wantWaits[i] {
+					t.Fatalf("waited %v, want %v", clock.waits, tt.wantWaits)
+				}
+			}
+		})
+	}
+}
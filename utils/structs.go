@@ -1,12 +1,10 @@
 package utils
 
-import (
-	"math"
-	"time"
-)
-
-// AlbumItems to hold an array of Album
+// AlbumItems to hold an array of Album. AlbumGroup tells how the album
+// relates to the artist it was listed for and is only sent in an artist's
+// albums.
 type SimplifiedAlbum struct {
+	AlbumGroup           string             `json:"album_group,omitempty"`
 	AlbumType            string             `json:"album_type"`
 	Artists              []SimplifiedArtist `json:"artists"`
 	AvailableMarkets     []string           `json:"available_markets"`
@@ -17,11 +15,37 @@ type SimplifiedAlbum struct {
 	Name                 string             `json:"name"`
 	ReleaseDate          string             `json:"release_date"`
 	ReleaseDatePrecision string             `json:"release_date_precision"`
-	Restrictions         string             `json:"restrictions"`
+	Restrictions         *Restrictions      `json:"restrictions,omitempty"`
+	TotalTracks          int                `json:"total_tracks"`
 	Type                 string             `json:"type"`
 	Uri                  string             `json:"uri"`
 }
 
+// FullAlbum for working with the full album object, which also carries the
+// first page of the album's tracks
+type FullAlbum struct {
+	SimplifiedAlbum
+	AlbumDetails
+
+	Tracks SoundtrackPage `json:"tracks"`
+}
+
+// AlbumDetails holds what only the full album object tells about an album
+type AlbumDetails struct {
+	Copyrights  []Copyright `json:"copyrights"`
+	ExternalIds ExternalId  `json:"external_ids"`
+	Genres      []string    `json:"genres"`
+	Label       string      `json:"label"`
+	Popularity  int         `json:"popularity"`
+}
+
+// Copyright is a copyright statement of an album, of type "C" for the
+// copyright and "P" for the sound recording (performance) copyright
+type Copyright struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
 // AlbumArt to hold images
 type AlbumArt struct {
 	Height int    `json:"height"`
@@ -51,6 +75,55 @@ type SimplifiedArtist struct {
 	ExternalUrls ExternalUrl `json:"external_urls"`
 }
 
+// FullArtist for working with the full artist object
+type FullArtist struct {
+	ExternalUrls ExternalUrl `json:"external_urls"`
+	Followers    Followers   `json:"followers"`
+	Genres       []string    `json:"genres"`
+	Href         string      `json:"href"`
+	Id           string      `json:"id"`
+	Images       []AlbumArt  `json:"images"`
+	Name         string      `json:"name"`
+	Popularity   int         `json:"popularity"`
+	Type         string      `json:"type"`
+	Uri          string      `json:"uri"`
+}
+
+// Row returns the row of an artist table describing the artist
+func (a FullArtist) Row() ArtistRow {
+	row := ArtistRow{
+		Id:         a.Id,
+		Name:       a.Name,
+		Genres:     a.Genres,
+		Followers:  a.Followers.Total,
+		Popularity: a.Popularity,
+		Uri:        a.Uri,
+		SpotifyUrl: a.ExternalUrls.Spotify,
+	}
+	for _, image := range a.Images {
+		row.ImageUrls = append(row.ImageUrls, image.Url)
+	}
+	return row
+}
+
+// ArtistRow is a single row of an artist table
+type ArtistRow struct {
+	Id         string   `json:"id"`
+	Name       string   `json:"name"`
+	Genres     []string `json:"genres"`
+	Followers  int      `json:"followers"`
+	Popularity int      `json:"popularity"`
+	ImageUrls  []string `json:"image_urls"`
+	Uri        string   `json:"uri"`
+	SpotifyUrl string   `json:"spotify_url"`
+}
+
+// Followers holds the follower count of an artist
+type Followers struct {
+	Href  string `json:"href"`
+	Total int    `json:"total"`
+}
+
 // Soundtrack for working with sound tracks obtained from albums
 type SimplifiedSoundtrack struct {
 	Id   string `json:"id"`
@@ -69,9 +142,9 @@ type FullSoundtrack struct {
 	ExternalUrls     ExternalUrl        `json:"external_urls"`
 	Href             string             `json:"href"`
 	Id               string             `json:"id"`
-	IsPlayable       bool               `json:"is_playable"`
-	LinkedFrom       string             `json:"linked_from"`
-	Restrictions     string             `json:"restrictions"`
+	IsPlayable       *bool              `json:"is_playable,omitempty"`
+	LinkedFrom       *LinkedTrack       `json:"linked_from,omitempty"`
+	Restrictions     *Restrictions      `json:"restrictions,omitempty"`
 	Name             string             `json:"name"`
 	Popularity       int                `json:"popularity"`
 	PreviewUrl       string             `json:"preview_url"`
@@ -81,21 +154,255 @@ type FullSoundtrack struct {
 	IsLocal          bool               `json:"is_local"`
 }
 
-// RetryRequest is a mechanism to retry http requests after sometime
-type RetryRequest struct {
-	Attempt  int
-	Max      int
-	Min      int
-	Duration time.Duration
+// LinkedTrack is the track that was asked for when Spotify answers with
+// another one, playable in the requested market, in its place
+type LinkedTrack struct {
+	ExternalUrls ExternalUrl `json:"external_urls"`
+	Href         string      `json:"href"`
+	Id           string      `json:"id"`
+	Type         string      `json:"type"`
+	Uri          string      `json:"uri"`
+}
+
+// Restrictions tells why an album or track can't be played: "market",
+// "product" or "explicit"
+type Restrictions struct {
+	Reason string `json:"reason"`
 }
 
-// Backoff sets a time.Duration after which one should retry sending an http request
-func (r *RetryRequest) Backoff(cooldownTime int) {
-	multiplier := math.Pow(2, float64(r.Attempt)) * float64(r.Min)
-	sleep := time.Duration(multiplier)
+// CatalogRow is a single row of fetch output: a full soundtrack along with
+// the artist whose catalog it was fetched for. The details of the album, the
+// audio features of the track and the ids of duplicates merged into the row
+// are only there when asked for.
+type CatalogRow struct {
+	ArtistId string `json:"artist_id"`
+	FullSoundtrack
 
-	if float64(sleep) != multiplier || float64(sleep) > float64(r.Max) {
-		sleep = time.Duration(r.Max)
-	}
-	r.Duration = sleep + time.Duration(cooldownTime)
+	// Market is the country is_playable and restrictions refer to
+	Market string `json:"market,omitempty"`
+
+	AlbumDetails  *AlbumDetails  `json:"album_details,omitempty"`
+	AudioFeatures *AudioFeatures `json:"audio_features,omitempty"`
+	AlternateIds  []string       `json:"alternate_ids,omitempty"`
+}
+
+// AlbumRow is a single row of the albums output of fetch
+type AlbumRow struct {
+	ArtistId string `json:"artist_id"`
+	SimplifiedAlbum
+	AlbumDetails
+}
+
+// LookupRow is a single row of the mapping written by lookup: an ISRC or UPC
+// along with the track or album on Spotify carrying it. OtherIds lists the
+// other matches when there are several.
+type LookupRow struct {
+	CodeType    string     `json:"code_type"`
+	Code        string     `json:"code"`
+	Status      string     `json:"status"`
+	Matches     int        `json:"matches"`
+	Id          string     `json:"id"`
+	Name        string     `json:"name"`
+	Artists     []string   `json:"artists"`
+	Album       string     `json:"album"`
+	ReleaseDate string     `json:"release_date"`
+	ExternalIds ExternalId `json:"external_ids"`
+	Uri         string     `json:"uri"`
+	OtherIds    []string   `json:"other_ids"`
+}
+
+// AudioFeatures describes how a track sounds
+type AudioFeatures struct {
+	Acousticness     float64 `json:"acousticness"`
+	AnalysisUrl      string  `json:"analysis_url"`
+	Danceability     float64 `json:"danceability"`
+	DurationMs       int     `json:"duration_ms"`
+	Energy           float64 `json:"energy"`
+	Id               string  `json:"id"`
+	Instrumentalness float64 `json:"instrumentalness"`
+	Key              int     `json:"key"`
+	Liveness         float64 `json:"liveness"`
+	Loudness         float64 `json:"loudness"`
+	Mode             int     `json:"mode"`
+	Speechiness      float64 `json:"speechiness"`
+	Tempo            float64 `json:"tempo"`
+	TimeSignature    int     `json:"time_signature"`
+	TrackHref        string  `json:"track_href"`
+	Type             string  `json:"type"`
+	Uri              string  `json:"uri"`
+	Valence          float64 `json:"valence"`
+}
+
+// PrivateUser is the profile of the current user
+type PrivateUser struct {
+	Country      string      `json:"country"`
+	DisplayName  string      `json:"display_name"`
+	ExternalUrls ExternalUrl `json:"external_urls"`
+	Followers    Followers   `json:"followers"`
+	Href         string      `json:"href"`
+	Id           string      `json:"id"`
+	Product      string      `json:"product"`
+	Type         string      `json:"type"`
+	Uri          string      `json:"uri"`
+}
+
+// PublicUser is the public profile of a user
+type PublicUser struct {
+	DisplayName  string      `json:"display_name"`
+	ExternalUrls ExternalUrl `json:"external_urls"`
+	Href         string      `json:"href"`
+	Id           string      `json:"id"`
+	Type         string      `json:"type"`
+	Uri          string      `json:"uri"`
+}
+
+// Playlist describes a playlist, without its items
+type Playlist struct {
+	Description  string      `json:"description"`
+	ExternalUrls ExternalUrl `json:"external_urls"`
+	Href         string      `json:"href"`
+	Id           string      `json:"id"`
+	Name         string      `json:"name"`
+	Owner        PublicUser  `json:"owner"`
+	SnapshotId   string      `json:"snapshot_id"`
+	Tracks       Paging      `json:"tracks"`
+	Type         string      `json:"type"`
+	Uri          string      `json:"uri"`
+}
+
+// PlaylistItem is an entry of a playlist. Track is a track, an episode
+// decoded into the fields it shares with tracks, or nil when the entry is no
+// longer available. Local files are tracks without an id.
+type PlaylistItem struct {
+	AddedAt string          `json:"added_at"`
+	AddedBy PublicUser      `json:"added_by"`
+	IsLocal bool            `json:"is_local"`
+	Track   *FullSoundtrack `json:"track"`
+}
+
+// PlaylistRow is a single row of playlist output: a track along with where
+// and when it was added to the playlist
+type PlaylistRow struct {
+	PlaylistId string `json:"playlist_id"`
+	Position   int    `json:"position"`
+	AddedAt    string `json:"added_at"`
+	AddedBy    string `json:"added_by"`
+	FullSoundtrack
+
+	// Market is the country is_playable and restrictions refer to
+	Market string `json:"market,omitempty"`
+}
+
+// SavedTrack is a track saved in the library of the current user
+type SavedTrack struct {
+	AddedAt string         `json:"added_at"`
+	Track   FullSoundtrack `json:"track"`
+}
+
+// SavedAlbum is an album saved in the library of the current user
+type SavedAlbum struct {
+	AddedAt string    `json:"added_at"`
+	Album   FullAlbum `json:"album"`
+}
+
+// SavedTrackRow is a single row of the saved tracks output of library
+type SavedTrackRow struct {
+	AddedAt string `json:"added_at"`
+	FullSoundtrack
+
+	// Market is the country is_playable and restrictions refer to
+	Market string `json:"market,omitempty"`
+}
+
+// SavedAlbumRow is a single row of the saved albums output of library
+type SavedAlbumRow struct {
+	AddedAt string `json:"added_at"`
+	SimplifiedAlbum
+	AlbumDetails
+}
+
+// FollowedArtistRow is a single row of the followed artists output of
+// library
+type FollowedArtistRow struct {
+	ArtistRow
+}
+
+// Paging holds the fields shared by every paged response from Spotify
+type Paging struct {
+	Href     string `json:"href"`
+	Limit    int    `json:"limit"`
+	Next     string `json:"next"`
+	Offset   int    `json:"offset"`
+	Previous string `json:"previous"`
+	Total    int    `json:"total"`
+}
+
+// Cursors point at the items around a page of a cursor-based paged response
+type Cursors struct {
+	After  string `json:"after"`
+	Before string `json:"before"`
+}
+
+// CursorPaging holds the fields shared by every cursor-based paged response,
+// which are paged by the id of the last item seen rather than an offset
+type CursorPaging struct {
+	Cursors Cursors `json:"cursors"`
+	Href    string  `json:"href"`
+	Limit   int     `json:"limit"`
+	Next    string  `json:"next"`
+	Total   int     `json:"total"`
+}
+
+// AlbumPage is a single page of albums
+type AlbumPage struct {
+	Paging
+	Items []SimplifiedAlbum `json:"items"`
+}
+
+// ArtistPage is a single page of artists
+type ArtistPage struct {
+	Paging
+	Items []FullArtist `json:"items"`
+}
+
+// CursorArtistPage is a single cursor-based page of artists
+type CursorArtistPage struct {
+	CursorPaging
+	Items []FullArtist `json:"items"`
+}
+
+// PlaylistPage is a single page of playlists
+type PlaylistPage struct {
+	Paging
+	Items []Playlist `json:"items"`
+}
+
+// PlaylistItemPage is a single page of playlist items
+type PlaylistItemPage struct {
+	Paging
+	Items []PlaylistItem `json:"items"`
+}
+
+// SavedAlbumPage is a single page of saved albums
+type SavedAlbumPage struct {
+	Paging
+	Items []SavedAlbum `json:"items"`
+}
+
+// SavedTrackPage is a single page of saved tracks
+type SavedTrackPage struct {
+	Paging
+	Items []SavedTrack `json:"items"`
+}
+
+// FullSoundtrackPage is a single page of full soundtracks
+type FullSoundtrackPage struct {
+	Paging
+	Items []FullSoundtrack `json:"items"`
+}
+
+// SoundtrackPage is a single page of simplified soundtracks
+type SoundtrackPage struct {
+	Paging
+	Items []SimplifiedSoundtrack `json:"items"`
 }
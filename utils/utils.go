@@ -23,6 +23,30 @@ var clientSecret string = os.Getenv("CLIENT_SECRET")
 type OAuthToken struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
+
+	// Scope lists the scopes granted to the token, separated by spaces.
+	// It is empty for tokens saved by older versions of morag.
+	Scope string `json:"scope,omitempty"`
+}
+
+// MissingScopes returns those of scopes that were not granted to the token.
+// Nothing is reported missing when the granted scopes aren't known.
+func (token *OAuthToken) MissingScopes(scopes ...string) []string {
+	if token.Scope == "" {
+		return nil
+	}
+	granted := make(map[string]bool)
+	for _, scope := range strings.Fields(token.Scope) {
+		granted[scope] = true
+	}
+
+	var missing []string
+	for _, scope := range scopes {
+		if !granted[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
 }
 
 // ValidateAccessToken checks if access-token has expired or not by hitting Spotify
@@ -65,7 +89,12 @@ func (token *OAuthToken) GetNewAccessToken() error {
 	req.SetBasicAuth(clientId, clientSecret)
 
 	// fire away
-	response, _ := client.Do(req)
+	response, err := client.Do(req)
+	if err != nil {
+		log.Println("Error while refreshing token", err.Error())
+		return err
+	}
+	defer response.Body.Close()
 
 	// Persist the new token from http response
 	if err := token.SaveTokenToFile(response, true); err != nil {
@@ -111,6 +140,9 @@ func (token *OAuthToken) SaveTokenToFile(r *http.Response, refreshed bool) error
 		if ok {
 			token.AccessToken = accessToken
 		}
+		if scope, ok := result["scope"].(string); ok {
+			token.Scope = scope
+		}
 	}
 
 	// JSONify the authToken